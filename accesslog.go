@@ -0,0 +1,89 @@
+package mid
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// AccessLogOptions configures AccessLog.
+type AccessLogOptions struct {
+	Logger *slog.Logger // defaults to the Defaults' logger
+
+	// SampleRate is the fraction of successful (below 500) requests logged,
+	// between 0 and 1; zero logs every request. Server errors are always
+	// logged.
+	SampleRate float64
+
+	ExcludePaths []string                   // exact paths never logged, e.g. "/healthz"
+	Exclude      func(r *http.Request) bool // further requests never logged
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a deterministic clock.
+	Now func() time.Time
+}
+
+// AccessLog logs one record per request with its method, path, route pattern,
+// status, body bytes written and duration. Records for 5xx responses are
+// logged at Error level, 4xx at Warn and the rest at Info. The logger attaches
+// the request ID, so place AccessLog after RequestID.
+func AccessLog(opts AccessLogOptions) func(http.Handler) http.Handler {
+	logger := opts.Logger
+	if logger == nil {
+		logger = Defaults().logger()
+	} else {
+		logger = loggerWithRequestID(logger)
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(opts.ExcludePaths, r.URL.Path) || (opts.Exclude != nil && opts.Exclude(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rw := WrapResponseWriter(w)
+			start := opts.Now()
+			completed := false
+			defer func() {
+				status := rw.Status()
+				if !completed && !rw.Written() {
+					status = http.StatusInternalServerError // next panicked; net/http will drop the connection
+				}
+				if status < http.StatusInternalServerError && opts.SampleRate > 0 && rand.Float64() >= opts.SampleRate {
+					return
+				}
+
+				level := slog.LevelInfo
+				switch {
+				case status >= http.StatusInternalServerError:
+					level = slog.LevelError
+				case status >= http.StatusBadRequest:
+					level = slog.LevelWarn
+				}
+				logRequest(r.Context(), logger, level, r, status, rw.BytesWritten(), opts.Now().Sub(start))
+			}()
+
+			next.ServeHTTP(rw.Writer(), r)
+			completed = true
+		})
+	}
+}
+
+// logRequest writes one access log record.
+func logRequest(ctx context.Context, logger *slog.Logger, level slog.Level, r *http.Request, status int, bytes int64, d time.Duration) {
+	logger.LogAttrs(ctx, level, "mid: request",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", r.Pattern), // set by http.ServeMux, and so by Router
+		slog.Int("status", status),
+		slog.Int64("bytes", bytes),
+		slog.Duration("duration", d),
+	)
+}
@@ -0,0 +1,157 @@
+package mid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAccessLog checks the logged fields, level by status, request ID
+// propagation and path exclusion.
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	router := NewRouter()
+	router.POST("/users/{id}", Handler(UserHandler))
+	router.GET("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h := Chain(
+		RequestID(RequestIDOptions{Trust: func(r *http.Request) bool { return true }}),
+		AccessLog(AccessLogOptions{Logger: logger, ExcludePaths: []string{"/healthz"}}),
+	)(router)
+
+	request := httptest.NewRequest(http.MethodPost, "/users/7", strings.NewReader(`{"Name":"John"}`))
+	request.Header.Set("X-Request-ID", "abc")
+	h.ServeHTTP(httptest.NewRecorder(), request)
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", logs.String(), err)
+	}
+	want := map[string]any{
+		"level":      "INFO",
+		"method":     "POST",
+		"path":       "/users/7",
+		"route":      "POST /users/{id}",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(len(`{"Name":"Goodbye"}` + "\n")),
+		"request_id": "abc",
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, record[k])
+		}
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Error("expected a duration")
+	}
+
+	logs.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/7", strings.NewReader(`{`)))
+	if !strings.Contains(logs.String(), `"level":"WARN"`) || !strings.Contains(logs.String(), `"status":400`) {
+		t.Errorf("expected a client error to be logged at WARN, got %q", logs.String())
+	}
+
+	logs.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if logs.Len() != 0 {
+		t.Errorf("expected an excluded path not to be logged, got %q", logs.String())
+	}
+}
+
+// TestResponseWriterOptionalInterfaces checks that handlers behind AccessLog
+// and other wrapping middleware can type-assert http.Flusher and
+// http.Hijacker exactly when the underlying writer supports them.
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	var logs bytes.Buffer
+	stack := Chain(
+		AccessLog(AccessLogOptions{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}),
+		SecureHeaders(SecureHeadersOptions{}),
+	)
+
+	var flusher, hijacker bool
+	probe := stack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		if flusher {
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	recorder := httptest.NewRecorder()
+	probe.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !flusher || hijacker || !recorder.Flushed {
+		t.Errorf("recorder: expected only http.Flusher, got flusher %v, hijacker %v", flusher, hijacker)
+	}
+
+	var w http.ResponseWriter
+	stack(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { w = rw })).
+		ServeHTTP(plainWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+	_, flusher = w.(http.Flusher)
+	_, hijacker = w.(http.Hijacker)
+	if flusher || hijacker {
+		t.Errorf("plain writer: expected neither interface, got flusher %v, hijacker %v", flusher, hijacker)
+	}
+	if err := http.NewResponseController(w).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("plain writer: expected http.ErrNotSupported, got %v", err)
+	}
+
+	logs.Reset()
+	served := make(chan struct{})
+	hijack := stack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("server: expected http.Flusher")
+		}
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("server: expected http.Hijacker")
+			return
+		}
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("expected Hijack to succeed: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(served)
+		hijack.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	<-served // the access log is written once the handler returns
+	if string(body) != "hijacked" {
+		t.Errorf("expected the hijacked response, got %q", body)
+	}
+	if !strings.Contains(logs.String(), `"status":101`) {
+		t.Errorf("expected the hijack to be logged as 101, got %q", logs.String())
+	}
+
+	rw := WrapResponseWriter(httptest.NewRecorder())
+	if WrapResponseWriter(rw) != rw || WrapResponseWriter(rw.Writer()) != rw {
+		t.Error("expected an existing wrapper to be reused")
+	}
+}
+
+// plainWriter hides every optional interface of the writer it wraps.
+type plainWriter struct {
+	w http.ResponseWriter
+}
+
+func (p plainWriter) Header() http.Header         { return p.w.Header() }
+func (p plainWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+func (p plainWriter) WriteHeader(status int)      { p.w.WriteHeader(status) }
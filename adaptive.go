@@ -0,0 +1,169 @@
+package mid
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimitOptions configures an AdaptiveLimiter. Zero fields take the
+// defaults noted beside them.
+type AdaptiveLimitOptions struct {
+	InitialLimit int // defaults to 20
+	MinLimit     int // defaults to 1
+	MaxLimit     int // defaults to 1000
+
+	// Tolerance is how many times slower than the baseline the recent average
+	// latency may be before it counts as congestion. Defaults to 2.
+	Tolerance float64
+
+	// Backoff multiplies the limit on congestion or an error. Defaults to 0.9.
+	Backoff float64
+
+	// Window is roughly the number of samples the baseline latency averages
+	// over, so it follows a genuinely slower backend and a steady mix of fast
+	// and slow endpoints doesn't read as congestion. Defaults to 500.
+	Window int
+
+	// IsError reports whether a response status counts as a failure that
+	// should shrink the limit. Defaults to status >= 500.
+	IsError func(status int) bool
+
+	OnError ErrorRenderer // renders the 503; defaults to the Defaults' ErrorRenderer
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a deterministic clock.
+	Now func() time.Time
+}
+
+// AdaptiveLimiter is a concurrency limiter whose limit follows observed
+// latency and errors (additive increase, multiplicative decrease): while
+// requests are fast and succeed the limit grows by about one per limit's worth
+// of requests; when the recent average latency climbs past Tolerance times the
+// long-run average, or requests fail, it is cut by Backoff. Requests over the limit are rejected at
+// once with a 503.
+type AdaptiveLimiter struct {
+	opts AdaptiveLimitOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	recent   float64 // moving average latency over the last few samples, in ns
+	baseline float64 // moving average latency over about Window samples, in ns
+}
+
+// recentSamples is roughly how many samples the recent latency averages over:
+// enough that one slow response among fast ones isn't congestion, few enough
+// that a sustained slowdown shows within a handful of requests.
+const recentSamples = 20
+
+// NewAdaptiveLimiter returns an AdaptiveLimiter configured by opts.
+func NewAdaptiveLimiter(opts AdaptiveLimitOptions) *AdaptiveLimiter {
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = max(1000, opts.MinLimit)
+	}
+	if opts.InitialLimit < 1 {
+		opts.InitialLimit = 20
+	}
+	opts.InitialLimit = min(max(opts.InitialLimit, opts.MinLimit), opts.MaxLimit)
+	if opts.Tolerance <= 1 {
+		opts.Tolerance = 2
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = 0.9
+	}
+	if opts.Window < 1 {
+		opts.Window = 500
+	}
+	if opts.IsError == nil {
+		opts.IsError = func(status int) bool { return status >= http.StatusInternalServerError }
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &AdaptiveLimiter{opts: opts, limit: float64(opts.InitialLimit)}
+}
+
+// AdaptiveLimit returns middleware backed by a new AdaptiveLimiter. Use
+// NewAdaptiveLimiter directly to observe the limit.
+func AdaptiveLimit(opts AdaptiveLimitOptions) func(http.Handler) http.Handler {
+	return NewAdaptiveLimiter(opts).Handler
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests currently being served.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Handler wraps next. It follows the func(http.Handler) http.Handler
+// convention.
+func (l *AdaptiveLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire() {
+			w.Header().Set("Retry-After", "1")
+			renderError(l.opts.OnError, w, r, NewHTTPError(http.StatusServiceUnavailable, ErrOverloaded))
+			return
+		}
+
+		rw := WrapResponseWriter(w)
+		start := l.opts.Now()
+		failed := true // a panic counts as a failure
+		defer func() { l.release(l.opts.Now().Sub(start), failed) }()
+
+		next.ServeHTTP(rw.Writer(), r)
+		failed = l.opts.IsError(rw.Status())
+	})
+}
+
+// acquire admits a request if the limit allows.
+func (l *AdaptiveLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release records a finished request's latency and outcome and adjusts the
+// limit.
+func (l *AdaptiveLimiter) release(rtt time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// only a limit that is being used has earned an increase
+	utilized := float64(l.inFlight) >= l.limit/2
+	l.inFlight--
+
+	// compare averages rather than single responses with the fastest seen, so
+	// cheap requests such as health checks or 404s don't make every normal
+	// request look congested
+	if l.baseline == 0 {
+		l.recent, l.baseline = float64(rtt), float64(rtt)
+	}
+	l.recent += (float64(rtt) - l.recent) * 2 / (recentSamples + 1)
+	l.baseline += (float64(rtt) - l.baseline) * 2 / float64(l.opts.Window+1)
+
+	congested := l.recent > l.baseline*l.opts.Tolerance
+	switch {
+	case failed || congested:
+		l.limit *= l.opts.Backoff
+	case utilized:
+		l.limit += 1 / l.limit
+	}
+	l.limit = math.Min(math.Max(l.limit, float64(l.opts.MinLimit)), float64(l.opts.MaxLimit))
+}
@@ -0,0 +1,120 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a deterministic clock advanced by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// TestAdaptiveLimiter drives the limiter with a fake clock: fast successes
+// under load grow the limit, slow responses and errors shrink it, and requests
+// over the limit are rejected with a 503.
+func TestAdaptiveLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewAdaptiveLimiter(AdaptiveLimitOptions{
+		InitialLimit: 4,
+		MaxLimit:     50,
+		Now:          clock.Now,
+	})
+
+	latency, status := 10*time.Millisecond, http.StatusOK
+	codes := map[int]int{}
+
+	// burst serves depth requests nested inside each other, so all of them are
+	// in flight at once and all observe the same latency
+	var handler http.Handler
+	var burst func(depth int)
+	handler = limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if depth := r.Context().Value(depthKey{}).(int); depth > 1 {
+			burst(depth - 1)
+		} else {
+			clock.Advance(latency)
+		}
+		w.WriteHeader(status)
+	}))
+	burst = func(depth int) {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		handler.ServeHTTP(recorder, r.WithContext(contextWithDepth(r.Context(), depth)))
+		codes[recorder.Code]++
+	}
+
+	for range 20 {
+		burst(limiter.Limit())
+	}
+	grown := limiter.Limit()
+	if grown <= 4 {
+		t.Fatalf("expected fast successes under load to grow the limit, got %d", grown)
+	}
+	if codes[http.StatusServiceUnavailable] != 0 {
+		t.Fatalf("expected no rejections within the limit, got %d", codes[http.StatusServiceUnavailable])
+	}
+
+	latency = 50 * time.Millisecond // 5x the baseline, sustained
+	for range 5 {
+		burst(1)
+	}
+	if got := limiter.Limit(); got >= grown {
+		t.Errorf("expected congestion to shrink the limit below %d, got %d", grown, got)
+	}
+
+	latency, status = 10*time.Millisecond, http.StatusInternalServerError
+	before := limiter.Limit()
+	burst(1)
+	if got := limiter.Limit(); got >= before {
+		t.Errorf("expected an error to shrink the limit below %d, got %d", before, got)
+	}
+
+	status = http.StatusOK
+	codes = map[int]int{}
+	burst(limiter.Limit() + 1)
+	if codes[http.StatusServiceUnavailable] != 1 {
+		t.Errorf("expected one request over the limit to be rejected, got codes %v", codes)
+	}
+	if limiter.InFlight() != 0 {
+		t.Errorf("expected nothing in flight, got %d", limiter.InFlight())
+	}
+}
+
+// TestAdaptiveLimiterMixedLatency verifies a steady mix of cheap and normal
+// requests, e.g. health checks beside real work, doesn't read as congestion.
+func TestAdaptiveLimiterMixedLatency(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewAdaptiveLimiter(AdaptiveLimitOptions{InitialLimit: 1, Now: clock.Now})
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			clock.Advance(time.Millisecond)
+		} else {
+			clock.Advance(20 * time.Millisecond)
+		}
+	}))
+
+	for i := range 500 {
+		path := "/work"
+		if i%10 != 0 {
+			path = "/healthz"
+		}
+		before := limiter.Limit()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if got := limiter.Limit(); got < before {
+			t.Fatalf("request %d to %s cut the limit from %d to %d", i, path, before, got)
+		}
+	}
+	if got := limiter.Limit(); got < 2 {
+		t.Errorf("expected the limit to grow under a steady mix, got %d", got)
+	}
+}
+
+type depthKey struct{}
+
+func contextWithDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, depthKey{}, depth)
+}
@@ -0,0 +1,221 @@
+package mid
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// FieldAuth is the struct tag key marking the field that receives the
+// authenticated principal, e.g. `auth:"" json:"-"`. The field is always
+// overwritten after decoding, so a client can't supply it in the body.
+const FieldAuth = "auth"
+
+// ErrUnauthorized is rendered, wrapped in a 401 HTTPError, when a request
+// carries no valid credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authenticator identifies the caller of a request. It returns the principal
+// (any value describing the caller, such as a user record) or an error when
+// the credentials are missing or invalid. An error that wraps an HTTPError
+// keeps its status; anything else is rendered as a 401.
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal any, err error)
+}
+
+// Challenger is implemented by Authenticators that know the WWW-Authenticate
+// challenge to send with a 401, e.g. `Bearer realm="api"`.
+type Challenger interface {
+	Challenge() string
+}
+
+// AuthenticatorFunc adapts an ordinary function to the Authenticator
+// interface.
+type AuthenticatorFunc func(r *http.Request) (any, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (any, error) {
+	return f(r)
+}
+
+// BearerAuth authenticates `Authorization: Bearer <token>` requests by passing
+// the token to Verify.
+type BearerAuth struct {
+	Realm  string
+	Verify func(ctx context.Context, token string) (any, error)
+}
+
+// Authenticate implements Authenticator.
+func (a BearerAuth) Authenticate(r *http.Request) (any, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrUnauthorized
+	}
+	return a.Verify(r.Context(), strings.TrimSpace(token))
+}
+
+// Challenge implements Challenger.
+func (a BearerAuth) Challenge() string {
+	return challenge("Bearer", a.Realm)
+}
+
+// BasicAuth authenticates HTTP Basic requests by passing the username and
+// password to Verify. Use CheckPassword to compare secrets in constant time.
+type BasicAuth struct {
+	Realm  string
+	Verify func(ctx context.Context, username, password string) (any, error)
+}
+
+// Authenticate implements Authenticator.
+func (a BasicAuth) Authenticate(r *http.Request) (any, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	return a.Verify(r.Context(), username, password)
+}
+
+// Challenge implements Challenger.
+func (a BasicAuth) Challenge() string {
+	return challenge("Basic", a.Realm)
+}
+
+// challenge formats a WWW-Authenticate value for scheme and an optional realm.
+func challenge(scheme, realm string) string {
+	if realm == "" {
+		return scheme
+	}
+	return fmt.Sprintf("%s realm=%q", scheme, realm)
+}
+
+// CheckPassword reports whether got equals want without leaking, through
+// timing, how much of it matched.
+func CheckPassword(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// principalKey is the context key RequireAuth stores the principal under.
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal.
+func ContextWithPrincipal(ctx context.Context, principal any) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored by RequireAuth, if any.
+func PrincipalFrom(ctx context.Context) (any, bool) {
+	p := ctx.Value(principalKey{})
+	return p, p != nil
+}
+
+// Identity is implemented by principals that carry a stable, unique ID, such
+// as a user record's primary key. KeyByPrincipal keys clients by it.
+type Identity interface {
+	PrincipalID() string
+}
+
+// principalID returns a stable ID for p: a non-empty string principal, the
+// subject of Claims, or the PrincipalID of an Identity. Anything else has
+// none, and "" is returned.
+func principalID(p any) string {
+	switch p := p.(type) {
+	case string:
+		return p
+	case Claims:
+		return p.Subject()
+	case Identity:
+		return p.PrincipalID()
+	}
+	return ""
+}
+
+// RequireAuth rejects requests that a fails to authenticate, rendering a 401
+// (with a WWW-Authenticate header when a is a Challenger) through onErr, or
+// the Defaults' ErrorRenderer when onErr is nil. Authenticated requests
+// continue with the principal in their context, where PrincipalFrom and
+// `auth` tagged input fields pick it up.
+func RequireAuth(a Authenticator, onErr ErrorRenderer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := a.Authenticate(r)
+			if err == nil && principal == nil {
+				err = ErrUnauthorized
+			}
+			if err != nil {
+				if _, ok := errors.AsType[*HTTPError](err); !ok {
+					err = NewHTTPError(http.StatusUnauthorized, ErrUnauthorized)
+				}
+				if c, ok := a.(Challenger); ok && StatusCode(err) == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", c.Challenge())
+				}
+				renderError(onErr, w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// fieldBinding fills one input field from the request after decoding, so the
+// value comes from a trusted source rather than the client's body.
+type fieldBinding struct {
+	Name  string // for error messages only
+	Index int
+	bind  func(r *http.Request, field reflect.Value) error
+}
+
+// scanBindings walks t once and records the exported fields bound from the
+// request context: those tagged `auth` or `claims`.
+func scanBindings(t reflect.Type) []fieldBinding {
+	var bindings []fieldBinding
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := field.Tag.Lookup(FieldAuth); ok {
+			bindings = append(bindings, fieldBinding{Name: field.Name, Index: i, bind: bindPrincipal})
+		} else if claim := field.Tag.Get(FieldClaims); claim != "" {
+			bindings = append(bindings, fieldBinding{Name: field.Name, Index: i, bind: bindClaim(claim)})
+		}
+	}
+	return bindings
+}
+
+// bindPrincipal sets field to the request's principal, or to its zero value
+// when the request wasn't authenticated.
+func bindPrincipal(r *http.Request, field reflect.Value) error {
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		field.SetZero()
+		return nil
+	}
+	return assignValue(field, reflect.ValueOf(p))
+}
+
+// assignValue sets field to v when v's type is assignable to it. A mismatch
+// is a programmer error, so it is reported as a 500.
+func assignValue(field, v reflect.Value) error {
+	if !v.Type().AssignableTo(field.Type()) {
+		return NewHTTPError(http.StatusInternalServerError,
+			fmt.Errorf("cannot bind %s to a field of type %s", v.Type(), field.Type()))
+	}
+	field.Set(v)
+	return nil
+}
+
+// applyBindings runs bindings against v, a non-nil pointer to a struct.
+func applyBindings(r *http.Request, v any, bindings []fieldBinding) error {
+	val := reflect.ValueOf(v).Elem()
+	for _, b := range bindings {
+		if err := b.bind(r, val.Field(b.Index)); err != nil {
+			return fmt.Errorf("field %s: %w", b.Name, err)
+		}
+	}
+	return nil
+}
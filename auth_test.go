@@ -0,0 +1,153 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type Account struct {
+	ID string
+}
+
+type CreateNote struct {
+	Owner Account `auth:"" json:"-"`
+	Text  string  `json:"text" validate:"required"`
+}
+
+// TestRequireAuth covers bearer and basic authentication, the 401 rendering
+// with its WWW-Authenticate challenge, and binding the principal into the
+// input so the body can't spoof it.
+func TestRequireAuth(t *testing.T) {
+	bearer := BearerAuth{Realm: "notes", Verify: func(ctx context.Context, token string) (any, error) {
+		if token != "secret" {
+			return nil, errors.New("bad token")
+		}
+		return Account{ID: "bearer-user"}, nil
+	}}
+	basic := BasicAuth{Realm: "notes", Verify: func(ctx context.Context, user, pass string) (any, error) {
+		if user != "ada" || !CheckPassword(pass, "hunter2") {
+			return nil, ErrUnauthorized
+		}
+		return Account{ID: "basic-user"}, nil
+	}}
+
+	handler := Handler(func(in CreateNote) (any, error) { return in.Owner, nil })
+
+	cases := []struct {
+		name          string
+		auth          Authenticator
+		setup         func(r *http.Request)
+		wantCode      int
+		wantBody      string
+		wantChallenge string
+	}{
+		{
+			name:     "bearer",
+			auth:     bearer,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			wantCode: http.StatusOK,
+			wantBody: `{"ID":"bearer-user"}` + "\n",
+		},
+		{
+			name:          "bearerInvalid",
+			auth:          bearer,
+			setup:         func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") },
+			wantCode:      http.StatusUnauthorized,
+			wantBody:      `{"error":"unauthorized"}` + "\n",
+			wantChallenge: `Bearer realm="notes"`,
+		},
+		{
+			name:     "basic",
+			auth:     basic,
+			setup:    func(r *http.Request) { r.SetBasicAuth("ada", "hunter2") },
+			wantCode: http.StatusOK,
+			wantBody: `{"ID":"basic-user"}` + "\n",
+		},
+		{
+			name:          "basicMissing",
+			auth:          basic,
+			setup:         func(r *http.Request) {},
+			wantCode:      http.StatusUnauthorized,
+			wantBody:      `{"error":"unauthorized"}` + "\n",
+			wantChallenge: `Basic realm="notes"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// the body tries to spoof the owner; the binding must win
+			body := `{"text":"hi","Owner":{"ID":"spoofed"}}`
+			request := httptest.NewRequest(http.MethodPost, "/notes", strings.NewReader(body))
+			c.setup(request)
+			recorder := httptest.NewRecorder()
+
+			RequireAuth(c.auth, nil)(handler).ServeHTTP(recorder, request)
+
+			if recorder.Code != c.wantCode {
+				t.Errorf("expected status %d, got %d", c.wantCode, recorder.Code)
+			}
+			if recorder.Body.String() != c.wantBody {
+				t.Errorf("unexpected response: %s", recorder.Body.String())
+			}
+			if got := recorder.Header().Get("WWW-Authenticate"); got != c.wantChallenge {
+				t.Errorf("expected challenge %q, got %q", c.wantChallenge, got)
+			}
+		})
+	}
+}
+
+// TestAuthBindingWithoutMiddleware verifies an `auth` field is zeroed when no
+// principal is present, and a mistyped principal is reported as a 500.
+func TestAuthBindingWithoutMiddleware(t *testing.T) {
+	var got CreateNote
+	handler := Handler(func(in CreateNote) (any, error) {
+		got = in
+		return nil, nil
+	})
+
+	serve(handler, `{"text":"hi","Owner":{"ID":"spoofed"}}`)
+	if got.Owner.ID != "" {
+		t.Errorf("expected the spoofed owner to be cleared, got %q", got.Owner.ID)
+	}
+
+	wrongType := AuthenticatorFunc(func(r *http.Request) (any, error) { return "just-a-string", nil })
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/notes", strings.NewReader(`{"text":"hi"}`))
+	RequireAuth(wrongType, nil)(handler).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d: %s", http.StatusInternalServerError, recorder.Code, recorder.Body.String())
+	}
+}
+
+type Profile struct {
+	Name string `mod:"upper"`
+}
+
+type UpdateProfile struct {
+	Owner *Profile `auth:"" json:"-"`
+	Bio   string   `json:"bio" mod:"trim"`
+}
+
+// TestAuthBindingAfterNormalization verifies modifiers run before the
+// principal is bound, so they can't change it through a pointer field.
+func TestAuthBindingAfterNormalization(t *testing.T) {
+	principal := &Profile{Name: "ada"}
+	auth := AuthenticatorFunc(func(r *http.Request) (any, error) { return principal, nil })
+	handler := RequireAuth(auth, nil)(Handler(func(in UpdateProfile) (any, error) { return in.Bio, nil }))
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/profile", strings.NewReader(`{"bio":"  hi  "}`))
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `"hi"`+"\n" {
+		t.Fatalf("expected the normalized bio, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if principal.Name != "ada" {
+		t.Errorf("expected the principal to be untouched, got %q", principal.Name)
+	}
+}
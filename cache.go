@@ -0,0 +1,334 @@
+package mid
+
+import (
+	"container/list"
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response kept by a CacheStore.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header // headers set by the handler
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time // stores may drop the response after this
+}
+
+// CacheStore keeps CachedResponses by key. Implementations must be safe for
+// concurrent use. Get may return expired responses; Cache ignores them.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (CachedResponse, bool, error)
+	Set(ctx context.Context, key string, resp CachedResponse) error
+}
+
+// CacheOptions configures Cache.
+type CacheOptions struct {
+	Store CacheStore    // defaults to NewMemoryCacheStore(64 << 20)
+	TTL   time.Duration // used when the response sets no max-age; defaults to 1 minute
+
+	// VaryHeaders are request headers that change the response, such as
+	// Accept-Language, and so are part of the cache key. Requests with an
+	// Authorization or Cookie header bypass the cache unless it is listed
+	// here, as do authenticated requests not keyed by either. Responses that
+	// Vary on a header not listed here aren't stored.
+	VaryHeaders []string
+
+	MaxBodyBytes int64 // larger responses aren't cached, nor buffered past this; defaults to 1 MiB
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a fixed clock.
+	Now func() time.Time
+}
+
+// Cache serves repeated GET and HEAD requests from a CacheStore. Requests are
+// keyed by method, host, path, query (with its parameters sorted) and
+// opts.VaryHeaders. Only 200 responses are stored, for their max-age (or
+// s-maxage) when they set one and opts.TTL otherwise; responses marked
+// no-store, no-cache or private, setting cookies, or varying on Vary: * or a
+// header the key doesn't include, never are. Requests sending Cache-Control:
+// no-cache skip the lookup, and no-store skips the cache entirely, as do
+// requests carrying credentials the key doesn't include. Hits carry an Age
+// header.
+//
+// Concurrent misses for one key are collapsed: one request runs next while
+// the others wait for its response.
+func Cache(opts CacheOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryCacheStore(64 << 20)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	vary := make(map[string]bool, len(opts.VaryHeaders))
+	for _, name := range opts.VaryHeaders {
+		vary[http.CanonicalHeaderKey(name)] = true
+	}
+
+	// personal reports whether r carries credentials the key doesn't
+	// include, so its response may be meant for that caller alone.
+	personal := func(r *http.Request) bool {
+		keyed := false
+		for _, name := range []string{"Authorization", "Cookie"} {
+			if r.Header.Get(name) != "" {
+				if !vary[name] {
+					return true
+				}
+				keyed = true
+			}
+		}
+		_, authenticated := PrincipalFrom(r.Context())
+		return authenticated && !keyed
+	}
+
+	var (
+		mu       sync.Mutex
+		inflight = map[string]*cacheCall{}
+	)
+
+	// store records rw's response under key if it may be cached, and returns
+	// it.
+	store := func(ctx context.Context, key string, rw *recordingWriter) (CachedResponse, bool) {
+		rw.snapshot()
+		if rw.Status() != http.StatusOK || rw.overflow || rw.header.Get("Set-Cookie") != "" {
+			return CachedResponse{}, false
+		}
+		directives := cacheDirectives(rw.header.Get("Cache-Control"))
+		for _, name := range []string{"no-store", "no-cache", "private"} {
+			if _, ok := directives[name]; ok {
+				return CachedResponse{}, false
+			}
+		}
+		for _, v := range rw.header.Values("Vary") {
+			for name := range strings.SplitSeq(v, ",") {
+				name = strings.TrimSpace(name)
+				if name == "*" || (name != "" && !vary[http.CanonicalHeaderKey(name)]) {
+					return CachedResponse{}, false
+				}
+			}
+		}
+		ttl := opts.TTL
+		for _, name := range []string{"s-maxage", "max-age"} {
+			if v, ok := directives[name]; ok {
+				if secs, err := strconv.Atoi(v); err == nil {
+					ttl = time.Duration(secs) * time.Second
+					break
+				}
+			}
+		}
+		if ttl <= 0 {
+			return CachedResponse{}, false
+		}
+		now := opts.Now()
+		resp := CachedResponse{Status: http.StatusOK, Header: rw.header, Body: rw.body.Bytes(), Stored: now, Expires: now.Add(ttl)}
+		if err := opts.Store.Set(context.WithoutCancel(ctx), key, resp); err != nil {
+			Defaults().logger().ErrorContext(ctx, "mid: store cached response", "err", err)
+		}
+		return resp, true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestDirectives := cacheDirectives(r.Header.Get("Cache-Control"))
+			_, noStore := requestDirectives["no-store"]
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || noStore || personal(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := cacheKey(r, opts.VaryHeaders)
+			ctx := r.Context()
+
+			if _, noCache := requestDirectives["no-cache"]; !noCache {
+				resp, found, err := opts.Store.Get(ctx, key)
+				if err != nil {
+					Defaults().logger().ErrorContext(ctx, "mid: read cached response", "err", err)
+				}
+				if found && opts.Now().Before(resp.Expires) {
+					writeCached(w, r, resp, opts.Now())
+					return
+				}
+			}
+
+			mu.Lock()
+			if call, ok := inflight[key]; ok {
+				mu.Unlock()
+				select {
+				case <-call.done:
+					if call.ok {
+						writeCached(w, r, call.resp, opts.Now())
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				// the response couldn't be shared; fetch our own
+				next.ServeHTTP(w, r)
+				return
+			}
+			call := &cacheCall{done: make(chan struct{})}
+			inflight[key] = call
+			mu.Unlock()
+
+			rw := &recordingWriter{ResponseWriter: WrapResponseWriter(w), before: w.Header().Clone(), limit: opts.MaxBodyBytes}
+			completed := false
+			defer func() {
+				if completed {
+					call.resp, call.ok = store(ctx, key, rw)
+				}
+				mu.Lock()
+				delete(inflight, key)
+				mu.Unlock()
+				close(call.done)
+			}()
+
+			next.ServeHTTP(exposeOptional(rw, w), r)
+			completed = true
+		})
+	}
+}
+
+// cacheCall is a miss being fetched, which concurrent requests for the same
+// key wait on. resp and ok are set before done is closed.
+type cacheCall struct {
+	done chan struct{}
+	resp CachedResponse
+	ok   bool
+}
+
+// writeCached writes resp with an Age header.
+func writeCached(w http.ResponseWriter, r *http.Request, resp CachedResponse, now time.Time) {
+	h := w.Header()
+	maps.Copy(h, resp.Header.Clone())
+	h.Set("Age", strconv.Itoa(max(0, int(now.Sub(resp.Stored).Seconds()))))
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+}
+
+// cacheKey identifies r's response: its method, host, path, sorted query and
+// the values of the vary headers.
+func cacheKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(strings.ToLower(r.Host))
+	b.WriteString(r.URL.EscapedPath())
+	if query, err := url.ParseQuery(r.URL.RawQuery); err == nil {
+		if q := query.Encode(); q != "" {
+			b.WriteByte('?')
+			b.WriteString(q)
+		}
+	} else {
+		b.WriteByte('?')
+		b.WriteString(r.URL.RawQuery)
+	}
+	for _, name := range vary {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// cacheDirectives parses a Cache-Control value into lower-cased directive
+// names and their (unquoted) values.
+func cacheDirectives(v string) map[string]string {
+	directives := map[string]string{}
+	for d := range strings.SplitSeq(v, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// MemoryCacheStore is an in-memory CacheStore bounded by the total size of
+// the responses it holds, least recently used evicted first.
+type MemoryCacheStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *cacheEntry, front is most recently used
+	entries  map[string]*list.Element
+}
+
+// cacheEntry is one response in a MemoryCacheStore.
+type cacheEntry struct {
+	key  string
+	resp CachedResponse
+	size int64
+}
+
+// NewMemoryCacheStore returns a store holding up to maxBytes of responses,
+// counting keys, headers and bodies.
+func NewMemoryCacheStore(maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{maxBytes: maxBytes, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get implements CacheStore.
+func (s *MemoryCacheStore) Get(ctx context.Context, key string) (CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return CachedResponse{}, false, nil
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).resp, true, nil
+}
+
+// Set implements CacheStore. Responses larger than the whole store are
+// ignored.
+func (s *MemoryCacheStore) Set(ctx context.Context, key string, resp CachedResponse) error {
+	size := int64(len(key) + len(resp.Body))
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			size += int64(len(k) + len(v))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	if size > s.maxBytes {
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, resp: resp, size: size})
+	s.size += size
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// Len returns the number of responses held.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// remove drops e. The caller holds s.mu.
+func (s *MemoryCacheStore) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	delete(s.entries, entry.key)
+	s.lru.Remove(e)
+	s.size -= entry.size
+}
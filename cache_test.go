@@ -0,0 +1,213 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCache checks hits, key normalization, TTLs, Cache-Control handling and
+// bypasses.
+func TestCache(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var calls atomic.Int32
+	router := NewRouter()
+	router.Use(Cache(CacheOptions{TTL: time.Minute, VaryHeaders: []string{"Accept-Language"}, Now: clock.Now}))
+	router.GET("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if cc := r.URL.Query().Get("cc"); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		if vary := r.URL.Query().Get("vary"); vary != "" {
+			w.Header().Set("Vary", vary)
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.Write([]byte(strconv.Itoa(int(n))))
+	}))
+
+	get := func(target string, headers ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i < len(headers); i += 2 {
+			request.Header.Set(headers[i], headers[i+1])
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	expect := func(rec *httptest.ResponseRecorder, body string) {
+		t.Helper()
+		if rec.Code != http.StatusOK || rec.Body.String() != body {
+			t.Errorf("expected 200 %q, got %d %q", body, rec.Code, rec.Body)
+		}
+	}
+
+	expect(get("/items?a=1&b=2"), "1")
+	clock.Advance(10 * time.Second)
+	hit := get("/items?b=2&a=1")
+	expect(hit, "1")
+	if hit.Header().Get("Age") != "10" || hit.Header().Get("Content-Type") != contentTypeJSON {
+		t.Errorf("expected a hit with the handler's headers and Age 10, got %v", hit.Header())
+	}
+	expect(get("/items?a=1&b=2", "Accept-Language", "de"), "2")
+	expect(get("/items?a=1&b=2", "Cache-Control", "no-cache"), "3")
+	expect(get("/items?a=1&b=2"), "3") // no-cache refreshed the entry
+	expect(get("/items?a=1&b=2", "Authorization", "Bearer x"), "4")
+
+	clock.Advance(time.Minute)
+	expect(get("/items?a=1&b=2"), "5")
+
+	expect(get("/items?cc=max-age=5"), "6")
+	expect(get("/items?cc=max-age=5"), "6")
+	clock.Advance(6 * time.Second)
+	expect(get("/items?cc=max-age=5"), "7")
+
+	expect(get("/items?cc=no-store"), "8")
+	expect(get("/items?cc=no-store"), "9")
+	expect(get("/items?cc=no-cache"), "10")
+	expect(get("/items?cc=no-cache"), "11")
+
+	// responses may only vary on headers in the key
+	expect(get("/items?vary=*"), "12")
+	expect(get("/items?vary=*"), "13")
+	expect(get("/items?vary=Accept-Encoding"), "14")
+	expect(get("/items?vary=Accept-Encoding"), "15")
+	expect(get("/items?vary=accept-language"), "16")
+	expect(get("/items?vary=accept-language"), "16")
+}
+
+// TestCachePersonal checks that requests carrying credentials outside the key
+// never share a response.
+func TestCachePersonal(t *testing.T) {
+	handler := Cache(CacheOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := ClaimsFrom(r.Context()); ok {
+			w.Write([]byte(claims.Subject()))
+		} else if c, err := r.Cookie("session"); err == nil {
+			w.Write([]byte(c.Value))
+		} else {
+			w.Write([]byte("anonymous"))
+		}
+	}))
+
+	get := func(principal any, cookie string) string {
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if cookie != "" {
+			request.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		if principal != nil {
+			request = request.WithContext(ContextWithPrincipal(request.Context(), principal))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+
+	get(nil, "") // caches the anonymous response
+	if alice, bob := get(nil, "alice"), get(nil, "bob"); alice != "alice" || bob != "bob" {
+		t.Errorf("expected each cookie user to get their own response, got %q and %q", alice, bob)
+	}
+	if got := get(Claims{"sub": "carol"}, ""); got != "carol" {
+		t.Errorf("expected an authenticated request to bypass the cache, got %q", got)
+	}
+}
+
+// TestCacheCollapsesMisses checks that concurrent misses run the handler once.
+func TestCacheCollapsesMisses(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Cache(CacheOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Go(func() {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			bodies[i] = recorder.Body.String()
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected one handler call, got %d", calls.Load())
+	}
+	for _, body := range bodies {
+		if body != "ok" {
+			t.Errorf("expected every request to get the response, got %q", body)
+		}
+	}
+}
+
+// TestMemoryCacheStore checks size-bounded LRU eviction.
+func TestMemoryCacheStore(t *testing.T) {
+	s := NewMemoryCacheStore(100)
+	ctx := t.Context()
+	body := make([]byte, 40)
+	s.Set(ctx, "a", CachedResponse{Body: body})
+	s.Set(ctx, "b", CachedResponse{Body: body})
+	s.Get(ctx, "a")
+	s.Set(ctx, "c", CachedResponse{Body: body})
+	if _, found, _ := s.Get(ctx, "b"); found || s.Len() != 2 {
+		t.Errorf("expected the least recently used entry to be evicted, got %d entries", s.Len())
+	}
+	s.Set(ctx, "d", CachedResponse{Body: make([]byte, 200)})
+	if _, found, _ := s.Get(ctx, "d"); found {
+		t.Error("expected a response larger than the store to be ignored")
+	}
+}
+
+// TestCacheHostAndLargeBodies verifies hosts get their own entries, and that
+// a response over MaxBodyBytes is passed through whole without being kept.
+func TestCacheHostAndLargeBodies(t *testing.T) {
+	var calls atomic.Int32
+	handler := Cache(CacheOptions{MaxBodyBytes: 4})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/large" {
+			w.Write([]byte("12"))
+			w.Write([]byte("345"))
+			w.Write([]byte("6"))
+			return
+		}
+		w.Write([]byte(r.Host))
+	}))
+	get := func(host, path string) string {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Host = host
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+
+	if a, b := get("a.io", "/"), get("b.io", "/"); a != "a.io" || b != "b.io" {
+		t.Errorf("expected each host's own response, got %q and %q", a, b)
+	}
+	if got := get("A.io", "/"); got != "a.io" || calls.Load() != 2 {
+		t.Errorf("expected the host to match case-insensitively, got %q after %d calls", got, calls.Load())
+	}
+
+	calls.Store(0)
+	for range 2 {
+		if got := get("a.io", "/large"); got != "123456" {
+			t.Errorf("expected the whole body, got %q", got)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected a large response not to be cached, got %d calls", calls.Load())
+	}
+
+	rw := &recordingWriter{ResponseWriter: WrapResponseWriter(httptest.NewRecorder()), limit: 4}
+	rw.Write([]byte("12"))
+	rw.Write([]byte("345"))
+	if !rw.overflow || rw.body.Len() != 0 {
+		t.Errorf("expected the copy to be dropped past the limit, got %d bytes", rw.body.Len())
+	}
+}
@@ -0,0 +1,135 @@
+package mid
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// contentTypeJSON is the Content-Type of every JSON response mid writes.
+const contentTypeJSON = "application/json; charset=utf-8"
+
+// BodyDecoder is the type-agnostic form of Decoder: it populates v, a non-nil
+// pointer to the handler's input struct, from the request.
+type BodyDecoder func(r *http.Request, v any) error
+
+// ResponseEncoder writes a successful handler result with the given status.
+// The Content-Type header has already been set by Handler.
+type ResponseEncoder func(w http.ResponseWriter, r *http.Request, status int, v any) error
+
+// Config carries the type-agnostic defaults every Handler call starts from, so
+// an application's error rendering, decoding, validation, logging, encoding,
+// metrics and tracing are configured once instead of repeated on every route.
+// Zero fields fall back to the package defaults. A Config must not be modified
+// once handlers have been built from it.
+type Config struct {
+	ErrorRenderer ErrorRenderer   // default JSONErrorRenderer
+	Decoder       BodyDecoder     // default DecodeJSON
+	Validator     Validate        // default DefaultValidator, as of when the Handler is built
+	Modifiers     *Modifiers      // default DefaultModifiers
+	Encoder       ResponseEncoder // default EncodeJSON
+	Logger        *slog.Logger    // default slog.Default()
+	Metrics       *HandlerMetrics // default none
+	Tracer        Tracer          // default none
+}
+
+// defaults holds the Config used by Handler. An atomic pointer lets services
+// install their defaults at startup without racing request goroutines.
+var defaults atomic.Pointer[Config]
+
+// SetDefaults makes a copy of c the Config that Handler inherits from.
+// Handlers built before the call keep the defaults they were built with.
+func SetDefaults(c Config) {
+	defaults.Store(&c)
+}
+
+// Defaults returns the Config that Handler inherits from.
+func Defaults() *Config {
+	if c := defaults.Load(); c != nil {
+		return c
+	}
+	return &Config{}
+}
+
+// renderer returns c.ErrorRenderer, or JSONErrorRenderer when unset.
+func (c *Config) renderer() ErrorRenderer {
+	if c.ErrorRenderer != nil {
+		return c.ErrorRenderer
+	}
+	return JSONErrorRenderer
+}
+
+// logger returns c.Logger, or a logger following slog.Default() when unset,
+// wrapped so records carry the request ID.
+func (c *Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return loggerWithRequestID(c.Logger)
+	}
+	return slog.New(requestIDLogHandler{defaultLogHandler{}})
+}
+
+// defaultLogHandler is a slog.Handler deferring to slog.Default()'s handler
+// at each call, so loggers built before slog.SetDefault still follow it.
+type defaultLogHandler struct{}
+
+// Enabled implements slog.Handler.
+func (defaultLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (defaultLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	return slog.Default().Handler().Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler. The derived handler is bound to the
+// current default.
+func (defaultLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return slog.Default().Handler().WithAttrs(attrs)
+}
+
+// WithGroup implements slog.Handler. The derived handler is bound to the
+// current default.
+func (defaultLogHandler) WithGroup(name string) slog.Handler {
+	return slog.Default().Handler().WithGroup(name)
+}
+
+// newSettings builds the per-Handler settings inherited from c.
+func newSettings[T any](c *Config) settings[T] {
+	s := settings[T]{
+		decode:    JSONDecoder[T],
+		validate:  NewStructValidator[T](DefaultValidator), // read once, so replacing it later can't race requests
+		onErr:     JSONErrorHandler[T],
+		encode:    EncodeJSON,
+		modifiers: DefaultModifiers,
+		logger:    c.logger(),
+		metrics:   c.Metrics,
+		tracer:    c.Tracer,
+	}
+	if c.Decoder != nil {
+		decode := c.Decoder
+		s.decode = func(r *http.Request, input *T) error { return decode(r, input) }
+	}
+	if c.Modifiers != nil {
+		s.modifiers = c.Modifiers
+	}
+	if c.Validator != nil {
+		s.validate = NewStructValidator[T](c.Validator)
+	}
+	if c.ErrorRenderer != nil {
+		render := c.ErrorRenderer
+		s.onErr = func(w http.ResponseWriter, r *http.Request, input T, err error) { render(w, r, err) }
+	}
+	if c.Encoder != nil {
+		s.encode = c.Encoder
+	}
+	return s
+}
+
+// EncodeJSON is the default ResponseEncoder: it writes status and v as JSON.
+func EncodeJSON(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package mid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandlerWithConfig verifies a Config's decoder, validator and error
+// renderer are inherited, and that per-route options still override them.
+func TestHandlerWithConfig(t *testing.T) {
+	cfg := &Config{
+		Decoder: DecodeStrictJSON,
+		Validator: ValidateFunc(func(s any) error {
+			return errors.New("config validator")
+		}),
+		ErrorRenderer: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusTeapot)
+		},
+	}
+
+	cases := []struct {
+		name     string
+		handler  http.Handler
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "strictDecoder",
+			handler:  HandlerWith(cfg, UserHandler),
+			body:     `{"Name":"x","Extra":1}`,
+			wantCode: http.StatusTeapot,
+			wantBody: `unknown field "Extra": invalid JSON` + "\n",
+		},
+		{
+			name:     "validator",
+			handler:  HandlerWith(cfg, UserHandler),
+			body:     `{"Name":"x"}`,
+			wantCode: http.StatusTeapot,
+			wantBody: "config validator\n",
+		},
+		{
+			name:     "routeOverride",
+			handler:  HandlerWith(cfg, UserHandler, WithValidator(func(User) error { return nil })),
+			body:     `{"Name":"x"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"Name":"Goodbye"}` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := serve(c.handler, c.body)
+
+			if recorder.Code != c.wantCode {
+				t.Errorf("expected status %d, got %d", c.wantCode, recorder.Code)
+			}
+			if recorder.Body.String() != c.wantBody {
+				t.Errorf("unexpected response: %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestSetDefaults verifies Handler inherits the package Defaults at build time.
+func TestSetDefaults(t *testing.T) {
+	t.Cleanup(func() { SetDefaults(Config{}) })
+
+	SetDefaults(Config{Decoder: DecodeStrictJSON})
+	strict := Handler(UserHandler)
+	SetDefaults(Config{})
+	lenient := Handler(UserHandler)
+
+	if code := serve(strict, `{"Extra":1}`).Code; code != http.StatusBadRequest {
+		t.Errorf("expected strict handler to reject unknown fields, got %d", code)
+	}
+	if code := serve(lenient, `{"Extra":1}`).Code; code != http.StatusOK {
+		t.Errorf("expected lenient handler to accept unknown fields, got %d", code)
+	}
+}
+
+// TestHandlerBuildTimeDefaults verifies a nil Config means the Defaults, that
+// DefaultValidator is read when the Handler is built, and that the default
+// logger follows slog.SetDefault.
+func TestHandlerBuildTimeDefaults(t *testing.T) {
+	saved, savedLogger := DefaultValidator, slog.Default()
+	t.Cleanup(func() { DefaultValidator = saved; slog.SetDefault(savedLogger) })
+
+	DefaultValidator = ValidateFunc(func(s any) error { return nil })
+	h := HandlerWith(nil, func(in User) (any, error) { return nil, errors.New("boom") })
+	DefaultValidator = ValidateFunc(func(s any) error { return errors.New("replaced") })
+	if body := serve(h, `{"Name":"x"}`).Body.String(); !strings.Contains(body, "boom") {
+		t.Errorf("expected the validator from build time, got %s", body)
+	}
+
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	Defaults().logger().Info("after build")
+	if !strings.Contains(logs.String(), "after build") {
+		t.Errorf("expected the default logger to follow slog.SetDefault, got %q", logs.String())
+	}
+}
+
+// TestDecodeStrictJSON verifies unknown members are reported with a typed
+// error at any depth, matching field names as encoding/json does.
+func TestDecodeStrictJSON(t *testing.T) {
+	type Inner struct {
+		Value string `json:"value"`
+	}
+	type Embedded struct {
+		Promoted int
+	}
+	type Input struct {
+		Embedded
+		Name   string           `json:"name"`
+		Skip   string           `json:"-"`
+		Items  []Inner          `json:"items"`
+		ByKey  map[string]Inner `json:"by_key"`
+		Opaque json.RawMessage  `json:"opaque"`
+	}
+	tests := []struct {
+		body, unknown string
+	}{
+		{`{"NAME":"x","promoted":1,"items":[{"value":"a"}],"by_key":{"k":{"value":"b"}},"opaque":{"any":1}}`, ""},
+		{`{"Skip":"x"}`, "Skip"},
+		{`{"items":[{"value":"a"},{"extra":1}]}`, "extra"},
+		{`{"by_key":{"k":{"other":1}}}`, "other"},
+	}
+	for _, tt := range tests {
+		var in Input
+		err := DecodeStrictJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)), &in)
+		ufe, ok := errors.AsType[*UnknownFieldError](err)
+		switch {
+		case tt.unknown == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.body, err)
+		case tt.unknown != "" && (!ok || ufe.Field != tt.unknown || !errors.Is(err, ErrJSONInvalid)):
+			t.Errorf("%s: expected unknown field %q, got %v", tt.body, tt.unknown, err)
+		}
+	}
+}
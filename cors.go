@@ -0,0 +1,157 @@
+package mid
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures CORS.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to call the API: exact values
+	// such as "https://app.example.com", patterns with one "*" such as
+	// "https://*.example.com", or "*" for any origin. The opaque "null"
+	// origin of sandboxed frames and file: pages is only allowed by "*".
+	AllowedOrigins []string
+
+	// AllowOrigin, when set, is consulted for origins AllowedOrigins doesn't
+	// match, other than "null".
+	AllowOrigin func(origin string) bool
+
+	AllowedMethods []string // defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedHeaders []string // request headers allowed; defaults to Content-Type and Authorization
+	ExposedHeaders []string // response headers scripts may read
+
+	// AllowCredentials lets browsers send cookies and HTTP auth, with the
+	// allowed origin echoed back as the spec requires. Combined with
+	// AllowedOrigins "*" it would let any site act as the user, so CORS panics
+	// on that; list the trusted origins instead.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response; zero omits
+	// the header and leaves it to the browser's default.
+	MaxAge time.Duration
+}
+
+// CORS answers cross-origin requests from allowed origins. Preflight requests
+// (OPTIONS with Access-Control-Request-Method) are answered with a 204 and
+// never reach next, so Handler doesn't try to decode their empty body; other
+// requests get the Access-Control-* headers and continue. Responses whose
+// headers depend on the origin carry Vary: Origin. It panics when
+// AllowedOrigins contains "*" and AllowCredentials is set.
+//
+// A Router's automatic OPTIONS responses go through its middleware, so
+// preflights reach CORS added with Use; with a bare http.ServeMux, wrap the
+// mux as a whole, since preflights match no route.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if len(opts.AllowedHeaders) == 0 {
+		opts.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	}
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	if anyOrigin && opts.AllowCredentials {
+		panic(`mid: CORS: AllowedOrigins "*" can't be combined with AllowCredentials`)
+	}
+	allowedHeaders := make(map[string]bool, len(opts.AllowedHeaders))
+	for _, h := range opts.AllowedHeaders {
+		allowedHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+
+	allowed := func(origin string) bool {
+		// "null" is shared by every sandboxed document, so it is never
+		// echoed; "*" answers it without naming it
+		if anyOrigin || origin == "null" {
+			return anyOrigin
+		}
+		for _, pattern := range opts.AllowedOrigins {
+			if matchOrigin(pattern, origin) {
+				return true
+			}
+		}
+		return opts.AllowOrigin != nil && opts.AllowOrigin(origin)
+	}
+
+	// setOrigin writes the headers shared by preflight and actual responses.
+	setOrigin := func(h http.Header, origin string) {
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			origin := r.Header.Get("Origin")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Origin")
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+
+				method := r.Header.Get("Access-Control-Request-Method")
+				requested := requestedHeaders(r.Header.Get("Access-Control-Request-Headers"))
+				ok := origin != "" && allowed(origin) && slices.Contains(opts.AllowedMethods, method)
+				for _, name := range requested {
+					ok = ok && allowedHeaders[name]
+				}
+				if ok {
+					// a disallowed preflight gets no CORS headers, which the
+					// browser reports as a failure
+					setOrigin(h, origin)
+					h.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+					h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+					if opts.MaxAge > 0 {
+						h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if !anyOrigin {
+				h.Add("Vary", "Origin")
+			}
+			if origin != "" && allowed(origin) {
+				setOrigin(h, origin)
+				if len(opts.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchOrigin reports whether origin matches pattern, which is either exact or
+// contains one "*" matching a non-empty run of characters. Origins are
+// compared case-insensitively.
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// requestedHeaders splits an Access-Control-Request-Headers value into
+// canonical header names.
+func requestedHeaders(v string) []string {
+	var names []string
+	for name := range strings.SplitSeq(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
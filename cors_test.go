@@ -0,0 +1,137 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCORS covers origin matching, preflight short-circuiting, credentials
+// and the Vary header.
+func TestCORS(t *testing.T) {
+	reached := false
+	users := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusCreated)
+	})
+	// preflights reach the Router's middleware through its automatic OPTIONS
+	// response
+	cors := NewRouter()
+	cors.Use(CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowCredentials: true,
+		ExposedHeaders:   []string{"X-Request-ID"},
+		MaxAge:           10 * time.Minute,
+	}))
+	cors.POST("/users", users)
+
+	do := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		reached = false
+		request := httptest.NewRequest(method, "/users", strings.NewReader(`{}`))
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		cors.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	preflight := map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type"}
+	recorder := do(http.MethodOptions, "https://pr-1.preview.example.com", preflight)
+	if recorder.Code != http.StatusNoContent || reached {
+		t.Errorf("expected the preflight to be answered without reaching the route, got %d (reached %v)", recorder.Code, reached)
+	}
+	for k, v := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://pr-1.preview.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := recorder.Header().Get(k); got != v {
+			t.Errorf("expected %s: %q, got %q", k, v, got)
+		}
+	}
+	if vary := recorder.Header().Values("Vary"); len(vary) != 3 || vary[0] != "Origin" {
+		t.Errorf("expected Vary on the preflight inputs, got %v", vary)
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"method": {"Access-Control-Request-Method": "TRACE"},
+		"header": {"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "X-Secret"},
+	} {
+		if recorder := do(http.MethodOptions, "https://app.example.com", headers); recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected a disallowed preflight to get no CORS headers", name)
+		}
+	}
+	if recorder := do(http.MethodOptions, "https://evil.com", preflight); recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected a preflight from an unknown origin to get no CORS headers")
+	}
+
+	recorder = do(http.MethodPost, "https://app.example.com", nil)
+	if recorder.Code != http.StatusCreated || !reached {
+		t.Errorf("expected the actual request to reach the route, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || recorder.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("unexpected CORS headers %v", recorder.Header())
+	}
+	if recorder.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected Vary: Origin, got %q", recorder.Header().Get("Vary"))
+	}
+
+	recorder = do(http.MethodPost, "https://example.com.evil.com", nil)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "" || !reached {
+		t.Error("expected an unknown origin to pass through without CORS headers")
+	}
+
+	for _, method := range []string{http.MethodOptions, http.MethodPost} {
+		if recorder := do(method, "null", preflight); recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected the null origin not to be echoed, got %v", method, recorder.Header())
+		}
+	}
+
+	// any origin without credentials is answered with "*"
+	open := CORS(CORSOptions{AllowedOrigins: []string{"*"}})(users)
+	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`))
+	request.Header.Set("Origin", "https://anywhere.test")
+	recorder = httptest.NewRecorder()
+	open.ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "*" || recorder.Header().Get("Vary") != "" {
+		t.Errorf("expected a wildcard origin without Vary, got %v", recorder.Header())
+	}
+
+	// credentials for any origin are refused when the middleware is built
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic for \"*\" with AllowCredentials")
+			}
+		}()
+		CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	}()
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		match           bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "HTTPS://APP.EXAMPLE.COM", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.com", false},
+		{"http://localhost:*", "http://localhost:3000", true},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.match {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package mid
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrCSRF is rendered, wrapped in a 403 HTTPError, when a request fails CSRF
+// protection.
+var ErrCSRF = errors.New("cross-site request rejected")
+
+// CSRFOptions configures CSRF.
+type CSRFOptions struct {
+	// TrustedOrigins are other origins, such as "https://app.example.com",
+	// allowed to make unsafe cross-origin requests.
+	TrustedOrigins []string
+
+	// DoubleSubmit also requires unsafe requests to echo the token from the
+	// CSRF cookie in the CSRF header. Enable it where browsers without
+	// Sec-Fetch-Site or Origin support matter. On its own it only proves the
+	// two match, so an attacker able to set cookies for the domain (from a
+	// sibling subdomain, or over plain HTTP) can plant a token of their own;
+	// set Secret and SessionID to rule that out.
+	DoubleSubmit bool
+
+	// Secret, with SessionID, signs double-submit tokens with HMAC-SHA256
+	// over the session's ID, so a token is only accepted for the session it
+	// was issued to. A token from an earlier session is replaced.
+	Secret    []byte
+	SessionID func(r *http.Request) string // e.g. the session cookie's value
+
+	CookieName     string // defaults to csrf_token
+	HeaderName     string // defaults to X-CSRF-Token
+	InsecureCookie bool   // omit the cookie's Secure flag, for local development over plain HTTP
+
+	// Exempt skips protection for matching requests, e.g. those authenticated
+	// by a bearer token rather than a cookie, which aren't CSRF-exposed.
+	Exempt func(r *http.Request) bool
+
+	OnError ErrorRenderer // renders the 403; defaults to the Defaults' ErrorRenderer
+}
+
+// csrfTokenKey is the context key CSRF stores the token under.
+type csrfTokenKey struct{}
+
+// CSRFTokenFrom returns the double-submit token for the request, set by CSRF
+// when DoubleSubmit is enabled, so it can be handed to the client.
+func CSRFTokenFrom(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// CSRF protects cookie-authenticated endpoints from cross-site request
+// forgery. Unsafe requests (anything but GET, HEAD and OPTIONS) that
+// Sec-Fetch-Site or the Origin header show to be cross-origin are rejected
+// unless the origin is trusted, as http.CrossOriginProtection does. With
+// DoubleSubmit, every request also gets a random token cookie, and unsafe
+// requests must send its value back in the CSRF header, which a cross-site
+// page can't read. Rejections are a 403 rendered through opts.OnError, in the
+// same JSON shape as any other error. It panics when Secret is set without
+// SessionID.
+func CSRF(opts CSRFOptions) func(http.Handler) http.Handler {
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if len(opts.Secret) > 0 && opts.SessionID == nil {
+		panic("mid: CSRF: Secret requires SessionID")
+	}
+	origins := http.NewCrossOriginProtection()
+	for _, origin := range opts.TrustedOrigins {
+		if err := origins.AddTrustedOrigin(origin); err != nil {
+			panic(fmt.Errorf("mid: CSRF: %w", err))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Exempt != nil && opts.Exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := origins.Check(r); err != nil {
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusForbidden, ErrCSRF))
+				return
+			}
+			if !opts.DoubleSubmit {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session := ""
+			if opts.SessionID != nil {
+				session = opts.SessionID(r)
+			}
+			token := ""
+			if c, err := r.Cookie(opts.CookieName); err == nil && validCSRFToken(c.Value, opts.Secret, session) {
+				token = c.Value
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				sent := r.Header.Get(opts.HeaderName)
+				if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					renderError(opts.OnError, w, r, NewHTTPError(http.StatusForbidden, ErrCSRF))
+					return
+				}
+			}
+
+			if token == "" {
+				token = newCSRFToken(opts.Secret, session)
+				http.SetCookie(w, &http.Cookie{
+					Name:     opts.CookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   !opts.InsecureCookie,
+					SameSite: http.SameSiteLaxMode,
+					// readable by scripts, which must copy it into the header
+					HttpOnly: false,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfTokenKey{}, token)))
+		})
+	}
+}
+
+// newCSRFToken returns 256 random bits, followed by their HMAC with session
+// when secret is set, base64url encoded.
+func newCSRFToken(secret []byte, session string) string {
+	b := make([]byte, 32, 64)
+	rand.Read(b)
+	if len(secret) > 0 {
+		b = append(b, csrfMAC(secret, b, session)...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validCSRFToken reports whether token is one newCSRFToken made with secret
+// for session.
+func validCSRFToken(token string, secret []byte, session string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return false
+	}
+	if len(secret) == 0 {
+		return len(b) == 32
+	}
+	return len(b) == 64 && hmac.Equal(b[32:], csrfMAC(secret, b[:32], session))
+}
+
+// csrfMAC returns the HMAC-SHA256, keyed by secret, of nonce and session.
+func csrfMAC(secret, nonce []byte, session string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	mac.Write([]byte(session))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,149 @@
+package mid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCSRFOrigin checks that cross-origin unsafe requests are rejected with a
+// JSON 403 unless the origin is trusted or the request exempt.
+func TestCSRFOrigin(t *testing.T) {
+	router := NewRouter()
+	router.Use(CSRF(CSRFOptions{
+		TrustedOrigins: []string{"https://app.example.com"},
+		Exempt:         func(r *http.Request) bool { return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") },
+	}))
+	router.POST("/users", Handler(UserHandler))
+	router.GET("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"same origin", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"no browser headers", http.MethodPost, nil, http.StatusOK},
+		{"cross site", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"cross origin without Sec-Fetch-Site", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"trusted origin", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.com"}, http.StatusOK},
+		{"exempt", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site", "Authorization": "Bearer x"}, http.StatusOK},
+		{"safe method", http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "http://api.example.com/users", strings.NewReader(`{"name":"John","email":"john@example.com"}`))
+			for k, v := range tt.headers {
+				request.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+			if tt.status != http.StatusForbidden {
+				return
+			}
+			var body JSONError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Error != ErrCSRF.Error() {
+				t.Errorf("expected the JSON error %q, got %s (%v)", ErrCSRF, recorder.Body, err)
+			}
+		})
+	}
+}
+
+// TestCSRFDoubleSubmit checks that a token cookie is issued and that unsafe
+// requests must echo it in the header.
+func TestCSRFDoubleSubmit(t *testing.T) {
+	var seen string
+	handler := CSRF(CSRFOptions{DoubleSubmit: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = CSRFTokenFrom(r.Context())
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || !cookies[0].Secure || cookies[0].HttpOnly || cookies[0].Value != seen {
+		t.Fatalf("expected a secure, script-readable token cookie matching the context token %q, got %v", seen, cookies)
+	}
+	token := cookies[0].Value
+
+	post := func(cookie, header string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		if cookie != "" {
+			request.AddCookie(&http.Cookie{Name: "csrf_token", Value: cookie})
+		}
+		if header != "" {
+			request.Header.Set("X-CSRF-Token", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if rec := post(token, token); rec.Code != http.StatusOK || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("expected a matching token to pass without a new cookie, got %d %v", rec.Code, rec.Result().Cookies())
+	}
+	if rec := post(token, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a missing header to be rejected, got %d", rec.Code)
+	}
+	if rec := post(token, newCSRFToken(nil, "")); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a mismatched header to be rejected, got %d", rec.Code)
+	}
+	if rec := post("", token); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a missing cookie to be rejected, got %d", rec.Code)
+	}
+	if rec := post("forged", "forged"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected a malformed token to be rejected, got %d", rec.Code)
+	}
+}
+
+// TestCSRFSignedToken verifies a signed token is only accepted for the
+// session it was issued to.
+func TestCSRFSignedToken(t *testing.T) {
+	handler := CSRF(CSRFOptions{
+		DoubleSubmit: true,
+		Secret:       []byte("0123456789abcdef0123456789abcdef"),
+		SessionID: func(r *http.Request) string {
+			c, _ := r.Cookie("session")
+			if c == nil {
+				return ""
+			}
+			return c.Value
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(method, session, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/", nil)
+		request.AddCookie(&http.Cookie{Name: "session", Value: session})
+		if token != "" {
+			request.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+			request.Header.Set("X-CSRF-Token", token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	cookies := do(http.MethodGet, "alice", "").Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a token cookie, got %v", cookies)
+	}
+	token := cookies[0].Value
+
+	if rec := do(http.MethodPost, "alice", token); rec.Code != http.StatusOK {
+		t.Errorf("expected the token to pass for its session, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "bob", token); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the token to be rejected for another session, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "alice", newCSRFToken(nil, "")); rec.Code != http.StatusForbidden {
+		t.Errorf("expected an unsigned token to be rejected, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "bob", token); len(rec.Result().Cookies()) != 1 {
+		t.Error("expected a token from another session to be replaced")
+	}
+}
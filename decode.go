@@ -1,10 +1,13 @@
 package mid
 
 import (
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
 // ErrJSONInvalid is returned for all JSON decoding errors that are safe to
@@ -19,20 +22,161 @@ var ErrJSONInvalid = errors.New("invalid JSON")
 // to inform both, as they can already discover the correct type: the message
 // leaks nothing the client doesn't already know.
 func JSONDecoder[T any](r *http.Request, input *T) error {
-	err := json.NewDecoder(r.Body).Decode(input)
+	return DecodeJSON(r, input)
+}
+
+// DecodeJSON is the type-agnostic JSONDecoder, usable as a Config.Decoder.
+func DecodeJSON(r *http.Request, v any) error {
+	return classifyJSONError(json.NewDecoder(r.Body).Decode(v))
+}
+
+// DecodeStrictJSON is DecodeJSON that also rejects fields the input struct
+// doesn't declare, with an *UnknownFieldError, usable as a Config.Decoder.
+func DecodeStrictJSON(r *http.Request, v any) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return classifyJSONError(err)
+	}
+	if field, ok := unknownJSONField(raw, reflect.TypeOf(v)); ok {
+		return &UnknownFieldError{Field: field}
+	}
+	return classifyJSONError(json.Unmarshal(raw, v))
+}
+
+// UnknownFieldError is returned by DecodeStrictJSON for a JSON object member
+// the input struct doesn't declare. It wraps ErrJSONInvalid.
+type UnknownFieldError struct {
+	Field string
+}
+
+// Error implements the error interface.
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q: %v", e.Field, ErrJSONInvalid)
+}
+
+// Unwrap returns ErrJSONInvalid.
+func (e *UnknownFieldError) Unwrap() error {
+	return ErrJSONInvalid
+}
+
+// classifyJSONError maps a json decoding error onto the messages clients see.
+func classifyJSONError(err error) error {
 	if err == nil {
 		return nil
 	}
-
-	switch e := err.(type) {
 	// json: cannot unmarshal string into Go struct field A.Foo of type string
-	case *json.UnmarshalTypeError:
+	if e, ok := errors.AsType[*json.UnmarshalTypeError](err); ok {
 		return fmt.Errorf("unexpected type '%s' for field '%s': %w", e.Value, e.Field, ErrJSONInvalid)
-	case *json.InvalidUnmarshalError:
-		// developer mistake (nil/non-pointer destination); keep the message
+	}
+	// developer mistake (nil/non-pointer destination); keep the message
+	if e, ok := errors.AsType[*json.InvalidUnmarshalError](err); ok {
 		return e
-	default:
-		// all other failures get a generic message
-		return ErrJSONInvalid
 	}
+	// all other failures get a generic message
+	return ErrJSONInvalid
+}
+
+// unmarshalerTypes are the interfaces that let a type decode itself, so
+// unknownJSONField can't tell which members it accepts.
+var unmarshalerTypes = []reflect.Type{
+	reflect.TypeFor[json.Unmarshaler](),
+	reflect.TypeFor[encoding.TextUnmarshaler](),
+}
+
+// unknownJSONField reports the first object member in data that t, or the
+// type of a member it is decoded into, has no field for. Members match field
+// names case-insensitively, as encoding/json does. Values that aren't valid
+// for t are left for the decoder to report.
+func unknownJSONField(data []byte, t reflect.Type) (string, bool) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "", false
+	}
+	for _, u := range unmarshalerTypes {
+		if reflect.PointerTo(t).Implements(u) {
+			return "", false
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var members map[string]json.RawMessage
+		if json.Unmarshal(data, &members) != nil {
+			return "", false
+		}
+		fields := jsonFields(t)
+		for name, value := range members {
+			field, ok := fields[name]
+			if !ok {
+				for fieldName, f := range fields {
+					if strings.EqualFold(fieldName, name) {
+						field, ok = f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return name, true
+			}
+			if name, ok := unknownJSONField(value, field); ok {
+				return name, true
+			}
+		}
+	case reflect.Map:
+		var members map[string]json.RawMessage
+		if json.Unmarshal(data, &members) != nil {
+			return "", false
+		}
+		for _, value := range members {
+			if name, ok := unknownJSONField(value, t.Elem()); ok {
+				return name, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if json.Unmarshal(data, &elems) != nil {
+			return "", false
+		}
+		for _, value := range elems {
+			if name, ok := unknownJSONField(value, t.Elem()); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// jsonFields maps the JSON names of t's fields to their types, promoting the
+// fields of embedded structs the way encoding/json does.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		embedded := field.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			for n, ft := range jsonFields(embedded) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = ft
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type // outer fields shadow promoted ones
+	}
+	return fields
 }
@@ -3,7 +3,6 @@ package mid
 import (
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
 )
 
@@ -11,27 +10,87 @@ import (
 // is not a struct — a programmer error caught at registration time.
 var ErrHandlerInputType = errors.New("handler input must be a struct")
 
-// JSONError is the default single-error response body.
+// JSONError is the default single-error response body. RequestID is set when
+// the RequestID middleware has run.
 type JSONError struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
-// JSONErrorHandler is the default ErrorHandler and the single place failed
-// requests are rendered. A ValidationErrors is written as its structured
-// {errors: [...]} body; anything else becomes a {error: "..."} message. Both
-// use a 400 status.
-func JSONErrorHandler[T any](w http.ResponseWriter, r *http.Request, input T, err error) {
-	w.WriteHeader(http.StatusBadRequest)
+// HTTPError is an error that carries the HTTP status it should be rendered
+// with. Handlers and middleware return one to pick a status other than the
+// default 400; the wrapped Err supplies the message.
+type HTTPError struct {
+	Status int
+	Err    error
+}
+
+// NewHTTPError returns an HTTPError with the given status. A nil err defaults
+// to the status text, e.g. "Not Found".
+func NewHTTPError(status int, err error) *HTTPError {
+	if err == nil {
+		err = errors.New(http.StatusText(status))
+	}
+	return &HTTPError{Status: status, Err: err}
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error, for errors.Is and errors.As.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode reports the status err should be rendered with: the Status of the
+// first HTTPError in its chain, or 400 Bad Request.
+func StatusCode(err error) int {
+	if he, ok := errors.AsType[*HTTPError](err); ok && he.Status != 0 {
+		return he.Status
+	}
+	return http.StatusBadRequest
+}
+
+// ErrorRenderer renders a failure that happens outside a Handler — in a Router
+// or middleware — where there is no decoded input. It is the type-agnostic
+// counterpart of ErrorHandler.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, err error)
 
-	var ve ValidationErrors
-	if errors.As(err, &ve) {
+// JSONErrorRenderer is the default ErrorRenderer and the single place failed
+// requests are rendered. A ValidationErrors (or any FieldErrorer) is written as
+// its structured {errors: [...]} body; anything else becomes a {error: "..."}
+// message. The status comes from StatusCode, so it is 400 unless err carries an
+// HTTPError. Both bodies include the request ID when RequestID has set one.
+func JSONErrorRenderer(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(StatusCode(err))
+
+	if fe, ok := errors.AsType[FieldErrorer](err); ok {
+		ve := ValidationErrors{Errors: fe.FieldErrors(), RequestID: RequestIDFrom(r.Context())}
 		if encErr := json.NewEncoder(w).Encode(ve); encErr != nil {
-			log.Println(encErr)
+			Defaults().logger().ErrorContext(r.Context(), "mid: encode error response", "err", encErr)
 		}
 		return
 	}
 
-	if encErr := json.NewEncoder(w).Encode(JSONError{err.Error()}); encErr != nil {
-		log.Println(encErr)
+	if encErr := json.NewEncoder(w).Encode(JSONError{Error: err.Error(), RequestID: RequestIDFrom(r.Context())}); encErr != nil {
+		Defaults().logger().ErrorContext(r.Context(), "mid: encode error response", "err", encErr)
+	}
+}
+
+// JSONErrorHandler is the default ErrorHandler. It ignores the input and
+// renders err with JSONErrorRenderer.
+func JSONErrorHandler[T any](w http.ResponseWriter, r *http.Request, input T, err error) {
+	JSONErrorRenderer(w, r, err)
+}
+
+// renderError renders err with render, falling back to the ErrorRenderer of
+// the package Defaults when render is nil.
+func renderError(render ErrorRenderer, w http.ResponseWriter, r *http.Request, err error) {
+	if render == nil {
+		render = Defaults().renderer()
 	}
+	render(w, r, err)
 }
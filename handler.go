@@ -1,11 +1,12 @@
 package mid
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 // HandlerFunc accepts an input struct and returns a value and error.
@@ -19,6 +20,13 @@ type Decoder[T any] func(r *http.Request, input *T) error
 // to the configured ErrorHandler; the Validator must not write to w itself.
 type Validator[T any] func(input T) error
 
+// Interceptor wraps the call to a HandlerFunc, seeing the validated input and
+// the handler's response and error. It calls next to continue (possibly with a
+// modified input), and may replace the result or skip the handler entirely.
+// This is middleware for code that needs the decoded input, such as audit
+// logging of the validated payload.
+type Interceptor[T any] func(r *http.Request, input T, next HandlerFunc[T]) (any, error)
+
 // ErrorHandler renders any failure (decode, validate, handler, encode) to the
 // client. It is the single place responses to failed requests are written.
 type ErrorHandler[T any] func(w http.ResponseWriter, r *http.Request, input T, err error)
@@ -26,13 +34,24 @@ type ErrorHandler[T any] func(w http.ResponseWriter, r *http.Request, input T, e
 // settings collects the pieces Handler needs. It starts from the package
 // defaults and is then customized by any Option passed to Handler.
 type settings[T any] struct {
-	decode   Decoder[T]
-	validate Validator[T]
-	onErr    ErrorHandler[T]
+	decode    Decoder[T]
+	transform Transformer[T] // nil until built from modifiers, unless overridden
+	modifiers *Modifiers
+	validate  Validator[T]
+	onErr     ErrorHandler[T]
+	encode    ResponseEncoder
+	logger    *slog.Logger
+	timeout   time.Duration
+	metrics   *HandlerMetrics
+	tracer    Tracer
+	observers []Observer[T]
+
+	interceptors []Interceptor[T]
 }
 
-// Option customizes a single Handler call. See WithDecoder, WithValidator,
-// and WithErrorHandler.
+// Option customizes a single Handler call. See WithDecoder, WithTransformer,
+// WithValidator, WithErrorHandler, WithEncoder, WithLogger, WithInterceptor,
+// WithTimeout, WithMetrics, WithTracer, and WithObserver.
 type Option[T any] func(*settings[T])
 
 // WithDecoder overrides the default JSONDecoder for one Handler call.
@@ -40,6 +59,11 @@ func WithDecoder[T any](d Decoder[T]) Option[T] {
 	return func(s *settings[T]) { s.decode = d }
 }
 
+// WithTransformer overrides the default StructTransformer for one Handler call.
+func WithTransformer[T any](t Transformer[T]) Option[T] {
+	return func(s *settings[T]) { s.transform = t }
+}
+
 // WithValidator overrides the default StructValidator for one Handler call.
 func WithValidator[T any](v Validator[T]) Option[T] {
 	return func(s *settings[T]) { s.validate = v }
@@ -50,22 +74,85 @@ func WithErrorHandler[T any](e ErrorHandler[T]) Option[T] {
 	return func(s *settings[T]) { s.onErr = e }
 }
 
+// WithEncoder overrides the default EncodeJSON for one Handler call.
+func WithEncoder[T any](e ResponseEncoder) Option[T] {
+	return func(s *settings[T]) { s.encode = e }
+}
+
+// WithLogger overrides the Config's logger for one Handler call. Like the
+// Config's, its records carry the request ID.
+func WithLogger[T any](l *slog.Logger) Option[T] {
+	return func(s *settings[T]) { s.logger = loggerWithRequestID(l) }
+}
+
+// WithInterceptor adds an Interceptor around the HandlerFunc call. It may be
+// given several times; the first interceptor added is the outermost.
+func WithInterceptor[T any](i Interceptor[T]) Option[T] {
+	return func(s *settings[T]) { s.interceptors = append(s.interceptors, i) }
+}
+
+// WithTimeout bounds how long one Handler may take. The request's context gets
+// a deadline d away (visible to Decoders and Interceptors); if the HandlerFunc
+// hasn't returned by then, a 504 wrapping ErrTimeout is routed to the
+// ErrorHandler and the late result is discarded. A HandlerFunc can't write to
+// the response itself, so nothing it does afterwards reaches the client.
+func WithTimeout[T any](d time.Duration) Option[T] {
+	return func(s *settings[T]) { s.timeout = d }
+}
+
+// WithMetrics overrides the Config's HandlerMetrics for one Handler call; nil
+// turns metrics off.
+func WithMetrics[T any](m *HandlerMetrics) Option[T] {
+	return func(s *settings[T]) { s.metrics = m }
+}
+
+// WithTracer overrides the Config's Tracer for one Handler call; nil turns
+// tracing off.
+func WithTracer[T any](t Tracer) Option[T] {
+	return func(s *settings[T]) { s.tracer = t }
+}
+
+// WithObserver adds an Observer to one Handler call. It may be given several
+// times; observers are called in the order added.
+func WithObserver[T any](o Observer[T]) Option[T] {
+	return func(s *settings[T]) { s.observers = append(s.observers, o) }
+}
+
 // Handler wraps a HandlerFunc into a net/http Handler, taking care of input
-// hydration (query params then JSON body), validation, and JSON responses.
-// Decoding, validation, and error handling default to JSONDecoder,
-// StructValidator, and JSONErrorHandler; override any of them individually with
-// WithDecoder/WithValidator/WithErrorHandler. Every failure — decode,
-// validation, the handler's own error, or a response-encoding error — is routed
-// through the single configured ErrorHandler.
+// hydration (query params, then the JSON body), normalization (`mod` tags),
+// `auth`/`claims` bindings, validation, and JSON responses. Decoding,
+// normalization, validation, and error handling default to JSONDecoder,
+// StructTransformer, StructValidator, and JSONErrorHandler; override any of
+// them individually with WithDecoder/WithTransformer/WithValidator/
+// WithErrorHandler. Every failure — decode, normalization, binding,
+// validation, or the handler's own error — is routed through the single
+// configured ErrorHandler.
+//
+// Handler inherits from the package Defaults; use HandlerWith to start from a
+// specific Config.
 func Handler[T any](handler HandlerFunc[T], opts ...Option[T]) http.Handler {
-	s := settings[T]{
-		decode:   JSONDecoder[T],
-		validate: StructValidator[T],
-		onErr:    JSONErrorHandler[T],
+	return HandlerWith(Defaults(), handler, opts...)
+}
+
+// HandlerWith is Handler starting from c instead of the package Defaults; a
+// nil c means the Defaults. Any opts are applied on top, so a single route can
+// still override c:
+//
+//	api := &mid.Config{Decoder: mid.DecodeStrictJSON, Logger: logger}
+//	mux.Handle("/users", mid.HandlerWith(api, createUser))
+func HandlerWith[T any](c *Config, handler HandlerFunc[T], opts ...Option[T]) http.Handler {
+	if c == nil {
+		c = Defaults()
 	}
+	s := newSettings[T](c)
 	for _, opt := range opts {
 		opt(&s)
 	}
+	if s.transform == nil {
+		// built after the options, so an overridden Transformer skips the
+		// default registry's checks
+		s.transform = NewStructTransformer[T](s.modifiers)
+	}
 
 	var inputType T
 	t := reflect.TypeOf(inputType)
@@ -73,42 +160,176 @@ func Handler[T any](handler HandlerFunc[T], opts ...Option[T]) http.Handler {
 		panic(fmt.Errorf("mid: %w", ErrHandlerInputType))
 	}
 
-	tags := scanFields(t, FieldQuery)
+	call := func(r *http.Request, input T) (any, error) { return handler(input) }
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		intercept, next := s.interceptors[i], call
+		call = func(r *http.Request, input T) (any, error) {
+			return intercept(r, input, func(input T) (any, error) { return next(r, input) })
+		}
+	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// JSON is the only supported transport
-		w.Header().Set("Content-Type", "application/json")
+	return &typedHandler[T]{
+		s:        s,
+		call:     call,
+		tags:     scanFields(t, FieldQuery),
+		bindings: scanBindings(t),
+	}
+}
 
-		var input T
+// typedHandler is the http.Handler returned by Handler. Besides serving
+// requests it remembers T, so tooling such as OpenAPI can describe the route
+// from the handler alone.
+type typedHandler[T any] struct {
+	s        settings[T]
+	call     func(r *http.Request, input T) (any, error) // HandlerFunc inside any interceptors
+	tags     []fieldTag
+	bindings []fieldBinding
+}
 
-		// URL parameters are set first
-		if err := applyQueryParams(r, &input, tags); err != nil {
-			s.onErr(w, r, input, err)
-			return
+// inputType implements describer.
+func (h *typedHandler[T]) inputType() reflect.Type {
+	return reflect.TypeFor[T]()
+}
+
+// Phase names a step of the Handler pipeline, as reported by HandlerMetrics and
+// traced as a span named "mid.<phase>".
+type Phase string
+
+// The phases of the Handler pipeline, in order.
+const (
+	PhaseQuery     Phase = "query"     // binding URL query parameters
+	PhaseDecode    Phase = "decode"    // decoding the body
+	PhaseTransform Phase = "transform" // `mod` normalization
+	PhaseBind      Phase = "bind"      // `auth` and `claims` bindings
+	PhaseValidate  Phase = "validate"  // validation
+	PhaseHandler   Phase = "handler"   // the HandlerFunc and its Interceptors
+	PhaseEncode    Phase = "encode"    // encoding the response
+)
+
+// phasePanic marks a request that panicked, in HandlerMetrics.
+const phasePanic Phase = "panic"
+
+// ServeHTTP runs the request through decode, normalize, bind, validate, call
+// and encode, routing any failure to the configured ErrorHandler.
+func (h *typedHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := &h.s
+
+	if s.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// JSON is the only supported transport
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if s.tracer != nil {
+		ctx, span := s.tracer.Start(ExtractTraceContext(r), "mid.Handler",
+			Attribute{"http.route", r.Pattern},
+			Attribute{"http.request.method", r.Method},
+			Attribute{"mid.input_type", reflect.TypeFor[T]().String()},
+		)
+		r = r.WithContext(ctx)
+		rw := WrapResponseWriter(w)
+		w = rw.Writer()
+		defer func() {
+			span.SetAttributes(Attribute{"http.response.status_code", rw.Status()})
+			span.End()
+		}()
+	}
+
+	if s.metrics == nil {
+		h.serve(w, r)
+		return
+	}
+
+	rw := WrapResponseWriter(w)
+	end := s.metrics.begin(r)
+	failed := phasePanic // unless serve returns
+	defer func() {
+		status := rw.Status()
+		if failed == phasePanic && !rw.Written() {
+			status = http.StatusInternalServerError
 		}
+		end(status, failed)
+	}()
+	failed = h.serve(rw.Writer(), r)
+}
 
+// serve runs the pipeline and returns the Phase that failed, or "" when the
+// request succeeded.
+func (h *typedHandler[T]) serve(w http.ResponseWriter, r *http.Request) Phase {
+	s := &h.s
+	var input T
+	var response any
+
+	steps := []struct {
+		phase Phase
+		run   func(r *http.Request) error
+	}{
+		// URL parameters are set first
+		{PhaseQuery, func(r *http.Request) error { return applyQueryParams(r, &input, h.tags) }},
 		// request body overwrites on key clash
-		if err := s.decode(r, &input); err != nil {
-			s.onErr(w, r, input, err)
-			return
+		{PhaseDecode, func(r *http.Request) error { return s.decode(r, &input) }},
+		// normalize before validating, so rules see the cleaned-up values
+		{PhaseTransform, func(r *http.Request) error { return s.transform(&input) }},
+		// trusted values (e.g. the authenticated principal) overwrite the body,
+		// after normalization so modifiers can't reach them
+		{PhaseBind, func(r *http.Request) error { return applyBindings(r, &input, h.bindings) }},
+		{PhaseValidate, func(r *http.Request) error { return s.validate(input) }},
+		{PhaseHandler, func(r *http.Request) (err error) {
+			if s.timeout > 0 {
+				response, err = callWithTimeout(r.Context(), h.call, r, input)
+			} else {
+				response, err = h.call(r, input)
+			}
+			return err
+		}},
+	}
+	for _, step := range steps {
+		var start time.Time
+		if len(s.observers) > 0 {
+			start = time.Now()
 		}
-
-		if err := s.validate(input); err != nil {
-			s.onErr(w, r, input, err)
-			return
+		var err error
+		if step.phase != PhaseBind || len(h.bindings) > 0 {
+			err = h.trace(r, step.phase, step.run)
+		}
+		for i := range s.observers {
+			s.observers[i].observe(r, step.phase, input, response, err, start)
 		}
-
-		response, err := handler(input)
 		if err != nil {
 			s.onErr(w, r, input, err)
-			return
+			return step.phase
 		}
+	}
 
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			// The status line is already sent, so we can't switch to an error
-			// response here; the connection is likely gone. Log and move on.
-			log.Println("mid: encode response:", err)
+	err := h.trace(r, PhaseEncode, func(r *http.Request) error { return s.encode(w, r, http.StatusOK, response) })
+	if err != nil {
+		// The status line is already sent, so we can't switch to an error
+		// response here; the connection is likely gone. Log and move on.
+		s.logger.ErrorContext(r.Context(), "mid: encode response", "err", err)
+		for _, o := range s.observers {
+			if o.OnEncodeError != nil {
+				o.OnEncodeError(r, input, response, err)
+			}
 		}
-	})
+		return PhaseEncode
+	}
+	return ""
+}
+
+// trace runs one phase of the pipeline, in a child span named after it when
+// a Tracer is configured.
+func (h *typedHandler[T]) trace(r *http.Request, phase Phase, run func(r *http.Request) error) error {
+	if h.s.tracer == nil {
+		return run(r)
+	}
+	ctx, span := h.s.tracer.Start(r.Context(), "mid."+string(phase))
+	defer span.End()
+	err := run(r.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
 }
@@ -3,6 +3,7 @@ package mid
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -124,13 +125,14 @@ func TestHandlerWithNilResponse(t *testing.T) {
 }
 
 // TestHandlerSetsContentType verifies Content-Type is set to application/json
-// before decoding even begins (here decoding fails on malformed JSON).
+// with an explicit charset before decoding even begins (here decoding fails on
+// malformed JSON).
 func TestHandlerSetsContentType(t *testing.T) {
 	handler := Handler(UserHandler)
 	recorder := serve(handler, `{bad json}`)
 
-	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
-		t.Errorf("expected Content-Type 'application/json', got '%s'", contentType)
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("expected Content-Type 'application/json; charset=utf-8', got '%s'", contentType)
 	}
 }
 
@@ -485,3 +487,75 @@ func BenchmarkMid(b *testing.B) {
 		}
 	}
 }
+
+// schemaErrors stands in for another validation library's error type that
+// reports field-level failures through FieldErrorer.
+type schemaErrors []FieldError
+
+func (s schemaErrors) Error() string             { return "schema violations" }
+func (s schemaErrors) FieldErrors() []FieldError { return s }
+
+// TestValidateFuncFieldErrorer verifies a non-go-playground Validate reports a
+// structured ValidationErrors through FieldErrorer, both via
+// NewStructValidator and when a custom Validator returns one directly.
+func TestValidateFuncFieldErrorer(t *testing.T) {
+	failing := ValidateFunc(func(s any) error {
+		return fmt.Errorf("wrapped: %w", schemaErrors{{Field: "/name", Tag: "minLength", Message: "too short"}})
+	})
+
+	want := `{"errors":[{"field":"/name","tag":"minLength","message":"too short"}]}` + "\n"
+
+	cases := []struct {
+		name string
+		opt  Option[User]
+	}{
+		{"NewStructValidator", WithValidator(NewStructValidator[User](failing))},
+		{"customValidator", WithValidator(func(u User) error { return failing.Struct(u) })},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := serve(Handler(UserHandler, c.opt), `{"name":"x"}`)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+			}
+			if recorder.Body.String() != want {
+				t.Errorf("unexpected response: %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestHandlerInterceptors verifies interceptors see the validated input and
+// the handler's result, run first-added outermost, and may short-circuit.
+func TestHandlerInterceptors(t *testing.T) {
+	var audit []string
+	auditor := func(name string) Interceptor[User] {
+		return func(r *http.Request, input User, next HandlerFunc[User]) (any, error) {
+			audit = append(audit, name+" in:"+input.Name)
+			resp, err := next(input)
+			audit = append(audit, fmt.Sprintf("%s out:%v err:%v", name, resp, err))
+			return resp, err
+		}
+	}
+
+	handler := Handler(UserHandler, WithInterceptor(auditor("outer")), WithInterceptor(auditor("inner")))
+	recorder := serve(handler, `{"Name":"example"}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	want := "outer in:example|inner in:example|inner out:{Goodbye} err:<nil>|outer out:{Goodbye} err:<nil>"
+	if got := strings.Join(audit, "|"); got != want {
+		t.Errorf("unexpected interceptor trace:\n%s", got)
+	}
+
+	deny := func(r *http.Request, input User, next HandlerFunc[User]) (any, error) {
+		return nil, NewHTTPError(http.StatusForbidden, nil)
+	}
+	recorder = serve(Handler(UserHandler, WithInterceptor(deny)), `{"Name":"example"}`)
+	if recorder.Code != http.StatusForbidden || recorder.Body.String() != `{"error":"Forbidden"}`+"\n" {
+		t.Errorf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
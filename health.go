@@ -0,0 +1,249 @@
+package mid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health statuses reported by Health.
+const (
+	HealthOK       = "ok"
+	HealthFail     = "fail"
+	HealthDraining = "draining"
+)
+
+// HealthCheck is one named check registered with a Health.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+
+	Timeout time.Duration // bounds one run of Check; defaults to HealthOptions.Timeout
+
+	// Liveness includes the check in liveness as well as readiness. Leave it
+	// false for dependencies such as databases: an outage there should take
+	// the instance out of rotation, not get it restarted.
+	Liveness bool
+}
+
+// HealthOptions configures a Health.
+type HealthOptions struct {
+	Timeout  time.Duration // default per-check timeout; defaults to 2 seconds
+	CacheTTL time.Duration // how long a check's result is reused; defaults to 1 second
+
+	// Readiness, when set, fails readiness while it is not ready. Pass the same
+	// Readiness to Serve with WithReadiness so readiness fails once draining
+	// starts.
+	Readiness *Readiness
+
+	// ExposeErrors reports each failing check's error in the response. By
+	// default a failure reads "check failed", since health endpoints are often
+	// public and errors can leak hostnames or credentials; the error itself is
+	// logged through the Defaults' logger either way.
+	ExposeErrors bool
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a deterministic clock.
+	Now func() time.Time
+}
+
+// CheckResult is the outcome of one check in a HealthReport.
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+
+	checked time.Time
+}
+
+// HealthReport is the aggregated JSON body served by the health handlers.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health runs registered checks concurrently, each bounded by its timeout,
+// and caches their results so frequent probes don't hammer dependencies. Its
+// LiveHandler and ReadyHandler serve the aggregated report.
+type Health struct {
+	opts HealthOptions
+
+	mu     sync.Mutex
+	checks []*healthEntry
+}
+
+// healthEntry is a registered check with its cached result. run serializes
+// runs, so concurrent probes share one result instead of all running it.
+type healthEntry struct {
+	HealthCheck
+	run    sync.Mutex
+	mu     sync.Mutex
+	result CheckResult
+}
+
+// NewHealth returns a Health configured by opts.
+func NewHealth(opts HealthOptions) *Health {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Second
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Health{opts: opts}
+}
+
+// Register adds a check. It panics when the check has no Name or Check, or
+// when another check already has its Name.
+func (h *Health) Register(check HealthCheck) {
+	if check.Name == "" || check.Check == nil {
+		panic("mid: HealthCheck requires a Name and a Check")
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = h.opts.Timeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.checks {
+		if c.Name == check.Name {
+			panic("mid: HealthCheck " + check.Name + " is already registered")
+		}
+	}
+	h.checks = append(h.checks, &healthEntry{HealthCheck: check})
+}
+
+// Live reports the checks registered with Liveness.
+func (h *Health) Live(ctx context.Context) HealthReport {
+	return h.report(ctx, true)
+}
+
+// Ready reports every check, and HealthDraining while the Readiness in
+// HealthOptions is not ready.
+func (h *Health) Ready(ctx context.Context) HealthReport {
+	report := h.report(ctx, false)
+	if h.opts.Readiness != nil && !h.opts.Readiness.Ready() {
+		report.Status = HealthDraining
+	}
+	return report
+}
+
+// LiveHandler serves Live: a 200 when every liveness check passes, a 503
+// otherwise.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, h.Live(r.Context()))
+	})
+}
+
+// ReadyHandler serves Ready: a 200 when every check passes and the server
+// isn't draining, a 503 otherwise.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, h.Ready(r.Context()))
+	})
+}
+
+// report runs the selected checks concurrently and aggregates the results.
+func (h *Health) report(ctx context.Context, liveOnly bool) HealthReport {
+	h.mu.Lock()
+	checks := make([]*healthEntry, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.Liveness || !liveOnly {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Go(func() { results[i] = h.result(ctx, c) })
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != HealthOK {
+			report.Status = HealthFail
+		}
+	}
+	return report
+}
+
+// result returns c's cached result, running the check when it is stale.
+func (h *Health) result(ctx context.Context, c *healthEntry) CheckResult {
+	fresh := func() (CheckResult, bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		ok := !c.result.checked.IsZero() && h.opts.Now().Sub(c.result.checked) < h.opts.CacheTTL
+		return c.result, ok
+	}
+	if res, ok := fresh(); ok {
+		return res
+	}
+
+	c.run.Lock()
+	defer c.run.Unlock()
+	if res, ok := fresh(); ok {
+		return res // another probe ran it while we waited
+	}
+
+	// the result is shared, so one probe hanging up mustn't fail it for others
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+	defer cancel()
+	start := h.opts.Now()
+	err := runCheck(checkCtx, c.Check)
+	end := h.opts.Now()
+
+	res := CheckResult{Status: HealthOK, Duration: float64(end.Sub(start)) / float64(time.Millisecond), checked: end}
+	if err != nil {
+		Defaults().logger().ErrorContext(ctx, "mid: health check failed", "check", c.Name, "err", err)
+		res.Status, res.Error = HealthFail, "check failed"
+		if h.opts.ExposeErrors {
+			res.Error = err.Error()
+		}
+	}
+	c.mu.Lock()
+	c.result = res
+	c.mu.Unlock()
+	return res
+}
+
+// runCheck calls check, giving up when ctx is done even if check ignores it.
+// A panicking check fails with the panic value rather than crashing the
+// process.
+func runCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1) // buffered, so a late check doesn't leak
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeHealthReport writes report as JSON with a 200 or 503 status.
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	status := http.StatusOK
+	if report.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,126 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHealth covers liveness versus readiness checks, result caching, check
+// timeouts, and readiness failing while draining.
+func TestHealth(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	ready := &Readiness{}
+	ready.SetReady(true)
+	health := NewHealth(HealthOptions{CacheTTL: time.Second, Readiness: ready, Now: clock.Now})
+
+	dbRuns, dbErr := 0, error(nil)
+	health.Register(HealthCheck{Name: "db", Check: func(ctx context.Context) error {
+		dbRuns++
+		return dbErr
+	}})
+	health.Register(HealthCheck{Name: "loop", Liveness: true, Check: func(ctx context.Context) error { return nil }})
+	health.Register(HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	get := func(h http.Handler) (int, HealthReport) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report HealthReport
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid report %q: %v", recorder.Body.String(), err)
+		}
+		return recorder.Code, report
+	}
+
+	code, report := get(health.LiveHandler())
+	if code != http.StatusOK || report.Status != HealthOK || len(report.Checks) != 1 {
+		t.Errorf("expected liveness to pass with only the liveness check, got %d %+v", code, report)
+	}
+
+	code, report = get(health.ReadyHandler())
+	if code != http.StatusServiceUnavailable || report.Status != HealthFail {
+		t.Errorf("expected readiness to fail on the slow check, got %d %+v", code, report)
+	}
+	if slow := report.Checks["slow"]; slow.Status != HealthFail || slow.Error != "check failed" {
+		t.Errorf("expected the slow check to time out, got %+v", slow)
+	}
+	if report.Checks["db"].Status != HealthOK {
+		t.Errorf("expected the db check to pass, got %+v", report.Checks["db"])
+	}
+
+	// results are cached until the TTL passes
+	dbErr = errors.New("connection refused")
+	get(health.ReadyHandler())
+	if dbRuns != 1 {
+		t.Errorf("expected the cached result to be reused, got %d runs", dbRuns)
+	}
+	clock.Advance(2 * time.Second)
+	_, report = get(health.ReadyHandler())
+	if dbRuns != 2 || report.Checks["db"].Status != HealthFail {
+		t.Errorf("expected a stale result to be refreshed, got %d runs and %+v", dbRuns, report.Checks["db"])
+	}
+
+	ready.SetReady(false)
+	if _, report = get(health.ReadyHandler()); report.Status != HealthDraining {
+		t.Errorf("expected readiness to report draining, got %q", report.Status)
+	}
+}
+
+// TestHealthErrors verifies check errors are logged, and only reported to
+// clients with ExposeErrors.
+func TestHealthErrors(t *testing.T) {
+	t.Cleanup(func() { SetDefaults(Config{}) })
+	var logs bytes.Buffer
+	SetDefaults(Config{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+
+	for _, expose := range []bool{false, true} {
+		logs.Reset()
+		health := NewHealth(HealthOptions{ExposeErrors: expose})
+		health.Register(HealthCheck{Name: "db", Check: func(ctx context.Context) error {
+			return errors.New("dial tcp db.internal:5432: connection refused")
+		}})
+
+		want := "check failed"
+		if expose {
+			want = "dial tcp db.internal:5432: connection refused"
+		}
+		if got := health.Ready(t.Context()).Checks["db"].Error; got != want {
+			t.Errorf("ExposeErrors %v: expected %q, got %q", expose, want, got)
+		}
+		if !strings.Contains(logs.String(), "db.internal:5432") {
+			t.Errorf("ExposeErrors %v: expected the error to be logged, got %q", expose, logs.String())
+		}
+	}
+}
+
+// TestHealthPanic verifies a panicking check fails instead of crashing the
+// process, and that a name can only be registered once.
+func TestHealthPanic(t *testing.T) {
+	health := NewHealth(HealthOptions{ExposeErrors: true})
+	health.Register(HealthCheck{Name: "cache", Check: func(ctx context.Context) error {
+		panic("nil pool")
+	}})
+
+	report := health.Ready(t.Context())
+	if report.Status != HealthFail || report.Checks["cache"].Error != "check panicked: nil pool" {
+		t.Errorf("expected the panic to fail the check, got %+v", report)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a duplicate name to panic")
+		}
+	}()
+	health.Register(HealthCheck{Name: "cache", Check: func(ctx context.Context) error { return nil }})
+}
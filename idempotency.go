@@ -0,0 +1,432 @@
+package mid
+
+import (
+	"bytes"
+	"container/heap"
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Errors rendered by Idempotency: a key longer than 255 characters is a 400,
+// a retry while the first request is still running a 409, a key reused for a
+// different request a 422, and a request whose key can't be scoped to its
+// caller a 500. MemoryIdempotencyStore fails with a 503 wrapping
+// ErrIdempotencyStoreFull when every key it holds is in flight.
+var (
+	ErrIdempotencyKey       = errors.New("invalid idempotency key")
+	ErrIdempotencyConflict  = errors.New("a request with this idempotency key is in progress")
+	ErrIdempotencyMismatch  = errors.New("idempotency key reused for a different request")
+	ErrIdempotencyScope     = errors.New("idempotency key can't be scoped to the caller")
+	ErrIdempotencyStoreFull = errors.New("too many idempotency keys in use")
+)
+
+// IdempotencyRecord is what an IdempotencyStore keeps per key: the request
+// fingerprint and, once the first request has completed, its response.
+type IdempotencyRecord struct {
+	Fingerprint string // hash of the method, URL and body
+	Token       string // identifies the request that reserved the key
+	Done        bool   // false while the first request is in flight
+
+	Status int
+	Header http.Header // headers set by the handler
+	Body   []byte
+}
+
+// IdempotencyStore keeps IdempotencyRecords. Implementations must be safe for
+// concurrent use, and Begin must be atomic so that only one request wins a
+// key, even across processes for a shared store. Errors wrapping an HTTPError
+// are rendered with its status, anything else as a 500.
+type IdempotencyStore interface {
+	// Begin reserves key with an in-flight record for fingerprint, held by
+	// the request identified by token and kept for ttl. If key is already
+	// taken, it returns the existing record and true instead.
+	Begin(ctx context.Context, key, fingerprint, token string, ttl time.Duration) (IdempotencyRecord, bool, error)
+
+	// Complete replaces key's in-flight record with the completed rec.
+	Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error
+
+	// Release forgets key if it is still reserved by token, so a retry runs
+	// the request again. A reservation that expired and was taken by another
+	// request must be left alone.
+	Release(ctx context.Context, key, token string) error
+}
+
+// IdempotencyOptions configures Idempotency.
+type IdempotencyOptions struct {
+	Store  IdempotencyStore // defaults to NewMemoryIdempotencyStore(10000)
+	Header string           // defaults to Idempotency-Key
+	TTL    time.Duration    // how long responses are replayed; defaults to 24 hours
+
+	// LockTTL is how long a key stays reserved by a request that hasn't
+	// completed, so a crashed instance can't block its key for the whole TTL;
+	// it defaults to one minute. Keep it above the slowest request, or a
+	// retry may run alongside the first.
+	LockTTL time.Duration
+
+	// Methods lists the methods keys are honored for; defaults to POST and
+	// PATCH. Other requests, and requests without a key, pass straight
+	// through.
+	Methods []string
+
+	// Record reports whether a response with status is recorded for replay.
+	// It defaults to 2xx and 3xx, so client errors, which a retry may well
+	// fix, run again like server errors do.
+	Record func(status int) bool
+
+	// Scope namespaces keys so clients can't replay each other's responses.
+	// It defaults to the principal's stable ID (as for KeyByPrincipal), or the
+	// client IP for anonymous requests. Requests it returns "" for, such as
+	// those from a principal without an ID, are rejected with a 500 rather
+	// than sharing a namespace. Place Idempotency after RequireAuth or
+	// JWTAuth.
+	Scope func(r *http.Request) string
+
+	OnError ErrorRenderer // renders rejections; defaults to the Defaults' ErrorRenderer
+}
+
+// Idempotency makes retries of unsafe requests carrying an Idempotency-Key
+// header safe. The first request with a key runs and its response is
+// recorded; retries with the same key, scope and body get that response
+// replayed, marked with Idempotent-Replayed: true, without reaching next. A
+// retry while the first request is still running gets a 409 with
+// Retry-After, and reuse of a key for a different method, URL or body a 422.
+//
+// Only successful and redirect responses are recorded by default; errors and
+// panics aren't, so the client can retry them. Bodies are read into memory to
+// be hashed; put MaxBodySize in front.
+func Idempotency(opts IdempotencyOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore(10000)
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = time.Minute
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.Scope == nil {
+		opts.Scope = idempotencyScope
+	}
+	if opts.Record == nil {
+		opts.Record = func(status int) bool {
+			return status >= http.StatusOK && status < http.StatusBadRequest
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(opts.Header)
+			if key == "" || !slices.Contains(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusBadRequest, ErrIdempotencyKey))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				renderError(opts.OnError, w, r, NewHTTPError(bodyErrorStatus(err), err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(r, body)
+			scope := opts.Scope(r)
+			if scope == "" {
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusInternalServerError, ErrIdempotencyScope))
+				return
+			}
+			key = scope + "\x00" + key
+
+			ctx := r.Context()
+			token := rand.Text()
+			rec, found, err := opts.Store.Begin(ctx, key, fingerprint, token, opts.LockTTL)
+			switch {
+			case err != nil:
+				if _, ok := errors.AsType[*HTTPError](err); !ok {
+					err = NewHTTPError(http.StatusInternalServerError, err)
+				}
+				renderError(opts.OnError, w, r, err)
+				return
+			case found && rec.Fingerprint != fingerprint:
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusUnprocessableEntity, ErrIdempotencyMismatch))
+				return
+			case found && !rec.Done:
+				w.Header().Set("Retry-After", "1")
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusConflict, ErrIdempotencyConflict))
+				return
+			case found:
+				h := w.Header()
+				maps.Copy(h, rec.Header.Clone())
+				h.Set("Idempotent-Replayed", "true")
+				w.WriteHeader(rec.Status)
+				w.Write(rec.Body)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: WrapResponseWriter(w), before: w.Header().Clone()}
+			completed := false
+			defer func() {
+				// the request's own context may be canceled by now
+				ctx := context.WithoutCancel(ctx)
+				status := rw.Status()
+				if !completed || !opts.Record(status) {
+					if err := opts.Store.Release(ctx, key, token); err != nil {
+						Defaults().logger().ErrorContext(ctx, "mid: release idempotency key", "err", err)
+					}
+					return
+				}
+				rw.snapshot()
+				rec := IdempotencyRecord{
+					Fingerprint: fingerprint,
+					Token:       token,
+					Done:        true,
+					Status:      status,
+					Header:      rw.header,
+					Body:        rw.body.Bytes(),
+				}
+				if err := opts.Store.Complete(ctx, key, rec, opts.TTL); err != nil {
+					Defaults().logger().ErrorContext(ctx, "mid: record idempotent response", "err", err)
+				}
+			}()
+
+			next.ServeHTTP(exposeOptional(rw, w), r)
+			completed = true
+		})
+	}
+}
+
+// idempotencyScope is the default IdempotencyOptions.Scope: the principal's
+// stable ID, the client IP for anonymous requests, or "" for a principal
+// without an ID.
+func idempotencyScope(r *http.Request) string {
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		return "ip:" + KeyByIP(r)
+	}
+	if id := principalID(p); id != "" {
+		return "principal:" + id
+	}
+	return ""
+}
+
+// bodyErrorStatus returns 413 when err is from a MaxBytesReader, else 400.
+func bodyErrorStatus(err error) int {
+	if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// requestFingerprint hashes what makes two requests "the same" for a key.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// changedHeaders returns the headers in after that differ from before: those
+// the handler set, as opposed to middleware that ran first.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			changed[k] = slices.Clone(v)
+		}
+	}
+	return changed
+}
+
+// recordingWriter keeps a copy of the body, and of the headers the handler
+// set by the time the status is written, while passing the response on.
+type recordingWriter struct {
+	*ResponseWriter
+	before http.Header // the headers before the handler ran
+	header http.Header // nil until snapshot
+	body   bytes.Buffer
+
+	// limit, when positive, caps the copy: once the body grows past it,
+	// the copy is dropped, overflow is set and the rest only passes through.
+	limit    int64
+	overflow bool
+}
+
+// snapshot records the headers changed since before, once.
+func (w *recordingWriter) snapshot() {
+	if w.header == nil {
+		w.header = changedHeaders(w.before, w.Header())
+	}
+}
+
+// WriteHeader snapshots the headers before passing status on.
+func (w *recordingWriter) WriteHeader(status int) {
+	if status >= http.StatusOK {
+		w.snapshot()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write copies b, up to the limit, before passing it on.
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.snapshot()
+	switch {
+	case w.overflow:
+	case w.limit > 0 && int64(w.body.Len()+len(b)) > w.limit:
+		w.overflow = true
+		w.body = bytes.Buffer{}
+	default:
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore holding up to a
+// fixed number of keys. When it is full, a new key evicts the oldest completed
+// response, never a request still in flight; only when every key is in flight
+// does Begin fail with a 503 wrapping ErrIdempotencyStoreFull. It suits a
+// single process; use a shared store when several instances serve the same
+// clients.
+type MemoryIdempotencyStore struct {
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a fixed clock.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	maxKeys int
+	entries map[string]*idempotencyEntry
+	expiry  idempotencyHeap // soonest to expire first
+	done    *list.List      // completed entries, oldest first
+}
+
+// idempotencyEntry is one key in a MemoryIdempotencyStore.
+type idempotencyEntry struct {
+	key     string
+	rec     IdempotencyRecord
+	expires time.Time
+	index   int           // in the expiry heap
+	done    *list.Element // in the done list, once completed
+}
+
+// NewMemoryIdempotencyStore returns a store holding up to maxKeys keys.
+func NewMemoryIdempotencyStore(maxKeys int) *MemoryIdempotencyStore {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &MemoryIdempotencyStore{Now: time.Now, maxKeys: maxKeys, entries: map[string]*idempotencyEntry{}, done: list.New()}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key, fingerprint, token string, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	s.expire(now)
+	if entry, ok := s.entries[key]; ok {
+		return entry.rec, true, nil
+	}
+	if err := s.add(key, IdempotencyRecord{Fingerprint: fingerprint, Token: token}, now.Add(ttl)); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	return IdempotencyRecord{}, false, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	s.expire(now)
+	if entry, ok := s.entries[key]; ok {
+		s.remove(entry)
+	}
+	// add rather than update in place, so the entry joins the done list
+	return s.add(key, rec, now.Add(ttl))
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok && !entry.rec.Done && entry.rec.Token == token {
+		s.remove(entry)
+	}
+	return nil
+}
+
+// add stores a new key, evicting the oldest completed one when the store is
+// full and failing when there is none. The caller holds s.mu.
+func (s *MemoryIdempotencyStore) add(key string, rec IdempotencyRecord, expires time.Time) error {
+	if len(s.entries) >= s.maxKeys {
+		oldest := s.done.Front()
+		if oldest == nil {
+			return NewHTTPError(http.StatusServiceUnavailable, ErrIdempotencyStoreFull)
+		}
+		s.remove(oldest.Value.(*idempotencyEntry))
+	}
+	entry := &idempotencyEntry{key: key, rec: rec, expires: expires}
+	heap.Push(&s.expiry, entry)
+	if rec.Done {
+		entry.done = s.done.PushBack(entry)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+// remove drops entry. The caller holds s.mu.
+func (s *MemoryIdempotencyStore) remove(entry *idempotencyEntry) {
+	heap.Remove(&s.expiry, entry.index)
+	if entry.done != nil {
+		s.done.Remove(entry.done)
+	}
+	delete(s.entries, entry.key)
+}
+
+// expire drops the keys whose TTL has passed by now. The caller holds s.mu.
+func (s *MemoryIdempotencyStore) expire(now time.Time) {
+	for len(s.expiry) > 0 && !now.Before(s.expiry[0].expires) {
+		s.remove(s.expiry[0])
+	}
+}
+
+// idempotencyHeap orders entries by expiry, implementing heap.Interface.
+type idempotencyHeap []*idempotencyEntry
+
+func (h idempotencyHeap) Len() int           { return len(h) }
+func (h idempotencyHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h idempotencyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *idempotencyHeap) Push(x any) {
+	entry := x.(*idempotencyEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *idempotencyHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,154 @@
+package mid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestIdempotency checks replays, conflicts, mismatches and that errors aren't
+// recorded.
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	router := NewRouter()
+	router.Use(Idempotency(IdempotencyOptions{}))
+	router.POST("/payments", Handler(func(u User) (any, error) {
+		calls.Add(1)
+		if u.Name == "slow" {
+			<-release
+		}
+		return map[string]any{"name": u.Name, "call": calls.Load()}, nil
+	}))
+	router.POST("/fail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	router.POST("/reject", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+
+	do := func(path, key, name string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"name":"`+name+`","email":"john@example.com"}`))
+		request.Header.Set("Idempotency-Key", key)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := do("/payments", "a", "John")
+	retry := do("/payments", "a", "John")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected the retry to replay %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if calls.Load() != 1 || retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != contentTypeJSON {
+		t.Errorf("expected one call and a marked replay with the handler's headers, got %d calls and %v", calls.Load(), retry.Header())
+	}
+
+	if rec := do("/payments", "a", "Jane"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a key reused with another body, got %d", rec.Code)
+	}
+	if rec := do("/payments", "b", "John"); rec.Code != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("expected a new key to run the handler, got %d after %d calls", rec.Code, calls.Load())
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- do("/payments", "c", "slow") }()
+	for calls.Load() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if rec := do("/payments", "c", "slow"); rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 409 with Retry-After while in flight, got %d %v", rec.Code, rec.Header())
+	}
+	close(release)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("expected the first request to finish, got %d", rec.Code)
+	}
+
+	do("/fail", "d", "John")
+	do("/fail", "d", "John")
+	if calls.Load() != 5 {
+		t.Errorf("expected server errors to be retried, got %d calls", calls.Load())
+	}
+
+	do("/reject", "e", "John")
+	do("/reject", "e", "John")
+	if calls.Load() != 7 {
+		t.Errorf("expected client errors to be retried, got %d calls", calls.Load())
+	}
+}
+
+// TestMemoryIdempotencyStore verifies keys expire with their TTL, that a full
+// store evicts the oldest completed key but never one in flight, and that a
+// release only drops the reservation it was made for.
+func TestMemoryIdempotencyStore(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	s := NewMemoryIdempotencyStore(2)
+	s.Now = clock.Now
+	ctx := t.Context()
+
+	s.Begin(ctx, "a", "fa", "t1", time.Minute)
+	if _, found, _ := s.Begin(ctx, "a", "fa", "t2", time.Minute); !found {
+		t.Fatal("expected the key to be taken")
+	}
+	clock.Advance(2 * time.Minute)
+	if _, found, _ := s.Begin(ctx, "a", "fa", "t3", time.Minute); found {
+		t.Fatal("expected the key to have expired")
+	}
+
+	// the first request's late release mustn't drop the retry's reservation
+	s.Release(ctx, "a", "t1")
+	if rec, found, _ := s.Begin(ctx, "a", "fa", "t4", time.Minute); !found || rec.Token != "t3" {
+		t.Fatalf("expected a stale release to leave the new reservation, got %v %+v", found, rec)
+	}
+
+	// a is in flight and b completed, so c evicts b
+	s.Begin(ctx, "b", "fb", "t5", time.Minute)
+	s.Complete(ctx, "b", IdempotencyRecord{Fingerprint: "fb", Done: true, Status: http.StatusCreated}, time.Hour)
+	if _, found, err := s.Begin(ctx, "c", "fc", "t6", time.Minute); found || err != nil {
+		t.Fatalf("expected c to evict the completed key, got %v %v", found, err)
+	}
+	if rec, found, _ := s.Begin(ctx, "a", "fa", "t7", time.Minute); !found || rec.Done {
+		t.Error("expected the in-flight key to be kept")
+	}
+
+	// with every key in flight there is nothing to evict
+	if _, _, err := s.Begin(ctx, "d", "fd", "t8", time.Minute); StatusCode(err) != http.StatusServiceUnavailable || !errors.Is(err, ErrIdempotencyStoreFull) {
+		t.Errorf("expected a store full of in-flight keys to refuse a new one with a 503, got %v", err)
+	}
+	s.Release(ctx, "c", "t6")
+	if _, found, err := s.Begin(ctx, "d", "fd", "t9", time.Minute); found || err != nil {
+		t.Errorf("expected the release to make room, got %v %v", found, err)
+	}
+}
+
+// TestIdempotencyScope verifies a principal without a stable ID is refused
+// rather than sharing keys with other such principals.
+func TestIdempotencyScope(t *testing.T) {
+	var calls atomic.Int32
+	handler := Idempotency(IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+
+	do := func(principal any) int {
+		request := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(`{}`))
+		request.Header.Set("Idempotency-Key", "k")
+		request = request.WithContext(ContextWithPrincipal(request.Context(), principal))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := do(&Account{ID: "a"}); code != http.StatusInternalServerError || calls.Load() != 0 {
+		t.Errorf("expected a principal without an ID to be refused, got %d after %d calls", code, calls.Load())
+	}
+	do(Claims{"sub": "alice"})
+	if code := do(Claims{"sub": "bob"}); code != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("expected each subject to get its own key, got %d after %d calls", code, calls.Load())
+	}
+}
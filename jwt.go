@@ -0,0 +1,283 @@
+package mid
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FieldClaims is the struct tag key binding a field to a verified JWT claim,
+// e.g. `claims:"sub" json:"-"`. Like `auth`, it is applied after decoding and
+// normalization, so neither the body nor a modifier can change the value.
+const FieldClaims = "claims"
+
+// Errors returned by JWTVerifier.Verify. RequireAuth renders all of them as a
+// 401 without revealing which check failed.
+var (
+	ErrTokenMalformed = errors.New("jwt: malformed token")
+	ErrTokenSignature = errors.New("jwt: invalid signature")
+	ErrTokenExpired   = errors.New("jwt: token expired")
+	ErrTokenNotYet    = errors.New("jwt: token not valid yet")
+	ErrTokenClaims    = errors.New("jwt: unexpected issuer or audience")
+)
+
+// Claims is the verified payload of a JWT.
+type Claims map[string]any
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// KeySet maps a JWT "kid" header to its verification key: a []byte secret for
+// HS256 or an ed25519.PublicKey for EdDSA. Publishing several kids at once is
+// how keys are rotated.
+type KeySet map[string]any
+
+// JWTVerifier verifies bearer JWTs signed with HS256 or EdDSA and checks their
+// registered claims. It implements Authenticator, with the Claims as the
+// principal.
+type JWTVerifier struct {
+	Keys     KeySet
+	Issuer   string        // when set, "iss" must match
+	Audience string        // when set, "aud" must contain it
+	Leeway   time.Duration // clock-skew tolerance for "exp" and "nbf"
+	Realm    string
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a fixed clock.
+	Now func() time.Time
+}
+
+// jwtHeader is the part of the JOSE header the verifier reads.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks token's signature and registered claims and returns its
+// claims.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		// a "null" payload decodes without error
+		return nil, ErrTokenMalformed
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// decodeSegment base64url-decodes a token segment and unmarshals its JSON.
+func decodeSegment(seg string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
+
+// verifySignature picks the key named by the header's kid (or the only key,
+// when there is one and no kid) and checks sig over signed. The algorithm must
+// agree with the key's type, so an HMAC secret can never be used to accept an
+// EdDSA token or vice versa.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	key, ok := v.Keys[header.Kid]
+	if !ok && header.Kid == "" && len(v.Keys) == 1 {
+		for _, only := range v.Keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return ErrTokenSignature
+	}
+
+	switch k := key.(type) {
+	case []byte:
+		if header.Alg != "HS256" {
+			return ErrTokenSignature
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrTokenSignature
+		}
+	case ed25519.PublicKey:
+		// ed25519.Verify panics on a key of the wrong size
+		if header.Alg != "EdDSA" || len(k) != ed25519.PublicKeySize || !ed25519.Verify(k, []byte(signed), sig) {
+			return ErrTokenSignature
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrTokenSignature, key)
+	}
+	return nil
+}
+
+// checkKeys reports a key Verify could never use: an unsupported type, an
+// empty HMAC secret, or an ed25519 key of the wrong size.
+func (v *JWTVerifier) checkKeys() error {
+	for kid, key := range v.Keys {
+		switch k := key.(type) {
+		case []byte:
+			if len(k) == 0 {
+				return fmt.Errorf("jwt: key %q: empty HMAC secret", kid)
+			}
+		case ed25519.PublicKey:
+			if len(k) != ed25519.PublicKeySize {
+				return fmt.Errorf("jwt: key %q: ed25519 public key is %d bytes, want %d", kid, len(k), ed25519.PublicKeySize)
+			}
+		default:
+			return fmt.Errorf("jwt: key %q: unsupported key type %T", kid, key)
+		}
+	}
+	return nil
+}
+
+// checkClaims validates exp, nbf, iss and aud. A present exp or nbf that isn't
+// a number makes the token malformed rather than unbounded.
+func (v *JWTVerifier) checkClaims(c Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	if raw, ok := c["exp"]; ok {
+		exp, ok := raw.(float64)
+		if !ok {
+			return ErrTokenMalformed
+		}
+		if !now.Before(unixTime(exp).Add(v.Leeway)) {
+			return ErrTokenExpired
+		}
+	}
+	if raw, ok := c["nbf"]; ok {
+		nbf, ok := raw.(float64)
+		if !ok {
+			return ErrTokenMalformed
+		}
+		if now.Add(v.Leeway).Before(unixTime(nbf)) {
+			return ErrTokenNotYet
+		}
+	}
+	if v.Issuer != "" && c["iss"] != v.Issuer {
+		return ErrTokenClaims
+	}
+	if v.Audience != "" {
+		switch aud := c["aud"].(type) {
+		case string:
+			if aud != v.Audience {
+				return ErrTokenClaims
+			}
+		case []any:
+			if !slices.Contains(aud, any(v.Audience)) {
+				return ErrTokenClaims
+			}
+		default:
+			return ErrTokenClaims
+		}
+	}
+	return nil
+}
+
+// maxUnixTime is the largest NumericDate, in seconds, whose nanoseconds fit
+// in an int64 (the year 2262).
+const maxUnixTime = float64(math.MaxInt64 / int64(time.Second))
+
+// unixTime converts a JWT NumericDate to a time.Time, clamping it to the
+// range of nanoseconds an int64 holds so huge values can't wrap around.
+func unixTime(sec float64) time.Time {
+	sec = max(-maxUnixTime, min(sec, maxUnixTime))
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+// Authenticate implements Authenticator, verifying the bearer token.
+func (v *JWTVerifier) Authenticate(r *http.Request) (any, error) {
+	return BearerAuth{Verify: func(ctx context.Context, token string) (any, error) {
+		return v.Verify(token)
+	}}.Authenticate(r)
+}
+
+// Challenge implements Challenger.
+func (v *JWTVerifier) Challenge() string {
+	return challenge("Bearer", v.Realm)
+}
+
+// JWTAuth rejects requests without a valid bearer JWT, rendering a 401 through
+// onErr (or the Defaults' ErrorRenderer when nil). Verified claims are placed
+// in the request context, where ClaimsFrom, `auth` fields of type Claims and
+// `claims` tagged fields pick them up. It panics if v holds a key it can't
+// verify with.
+func JWTAuth(v *JWTVerifier, onErr ErrorRenderer) func(http.Handler) http.Handler {
+	if err := v.checkKeys(); err != nil {
+		panic(fmt.Errorf("mid: JWTAuth: %w", err))
+	}
+	return RequireAuth(v, onErr)
+}
+
+// ClaimsFrom returns the claims stored by JWTAuth, if any.
+func ClaimsFrom(ctx context.Context) (Claims, bool) {
+	p, _ := PrincipalFrom(ctx)
+	c, ok := p.(Claims)
+	return c, ok
+}
+
+// bindClaim returns a binding that sets a field from the named claim, or to
+// its zero value when the request carries no such claim.
+func bindClaim(name string) func(r *http.Request, field reflect.Value) error {
+	return func(r *http.Request, field reflect.Value) error {
+		field.SetZero()
+
+		claims, _ := ClaimsFrom(r.Context())
+		value, ok := claims[name]
+		if !ok {
+			return nil
+		}
+
+		// claims are decoded JSON, so a JSON round trip converts them to the
+		// field's type the same way the body decoder would
+		raw, err := json.Marshal(value)
+		if err == nil {
+			err = json.Unmarshal(raw, field.Addr().Interface())
+		}
+		if err != nil {
+			return NewHTTPError(http.StatusInternalServerError, fmt.Errorf("claim %q: %w", name, err))
+		}
+		return nil
+	}
+}
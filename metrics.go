@@ -0,0 +1,341 @@
+package mid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used when none are
+// given; they suit typical HTTP latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is a small registry of counters, gauges and histograms that serves
+// itself in the Prometheus text exposition format, so services can expose
+// /metrics without an external client library:
+//
+//	metrics := mid.NewMetrics()
+//	mux.Handle("GET /metrics", metrics)
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// NewMetrics returns an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{families: map[string]*metricFamily{}}
+}
+
+// metricFamily is one named metric with all its labelled series.
+type metricFamily struct {
+	name, help, kind string
+	labels           []string
+	buckets          []float64 // histograms only
+
+	mu     sync.Mutex
+	series map[string]*metricSeries // keyed by the joined label values
+}
+
+// metricSeries is one combination of label values.
+type metricSeries struct {
+	labelValues []string
+	value       float64        // counter or gauge value, histogram sum
+	fn          func() float64 // gauge callback, read at scrape time
+	counts      []uint64       // histogram observations per bucket, not cumulative
+	count       uint64         // histogram observations
+}
+
+// register returns the family called name, creating it if needed. Registering
+// a name again with a different kind or labels is a programmer error.
+func (m *Metrics) register(name, help, kind string, buckets []float64, labels []string) *metricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.families[name]; ok {
+		if f.kind != kind || !slices.Equal(f.labels, labels) {
+			panic(fmt.Sprintf("mid: metric %q already registered as a %s with labels %v", name, f.kind, f.labels))
+		}
+		return f
+	}
+	f := &metricFamily{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*metricSeries{}}
+	m.families[name] = f
+	return f
+}
+
+// with returns the series for labelValues, creating it if needed. The caller
+// holds f.mu.
+func (f *metricFamily) with(labelValues []string) *metricSeries {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("mid: metric %q takes labels %v, got %d values", f.name, f.labels, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: slices.Clone(labelValues)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up, such as a request count.
+type Counter struct{ f *metricFamily }
+
+// Counter registers (or returns the existing) counter called name, with the
+// given label names.
+func (m *Metrics) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{m.register(name, help, "counter", nil, slices.Clone(labels))}
+}
+
+// Inc adds one to the series for labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series for labelValues.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("mid: counters can't decrease")
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.with(labelValues).value += v
+}
+
+// Gauge is a value that goes up and down, such as requests in flight.
+type Gauge struct{ f *metricFamily }
+
+// Gauge registers (or returns the existing) gauge called name, with the given
+// label names.
+func (m *Metrics) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m.register(name, help, "gauge", nil, slices.Clone(labels))}
+}
+
+// Set sets the series for labelValues to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value = v
+}
+
+// Add adds v, which may be negative, to the series for labelValues.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value += v
+}
+
+// Func makes the series for labelValues report fn() at every scrape, for
+// values owned elsewhere such as a queue length.
+func (g *Gauge) Func(fn func() float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).fn = fn
+}
+
+// Histogram counts observations, such as latencies, into buckets.
+type Histogram struct{ f *metricFamily }
+
+// Histogram registers (or returns the existing) histogram called name, with
+// the given upper bucket bounds (DefaultBuckets when nil) and label names.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &Histogram{m.register(name, help, "histogram", buckets, slices.Clone(labels))}
+}
+
+// Observe records v in the series for labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.with(labelValues)
+	if i, _ := slices.BinarySearch(h.f.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WriteText(w); err != nil {
+		Defaults().logger().ErrorContext(r.Context(), "mid: write metrics", "err", err)
+	}
+}
+
+// WriteText writes every metric in the Prometheus text exposition format,
+// sorted by name and labels so the output is stable.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	families := make([]*metricFamily, 0, len(m.families))
+	for _, f := range m.families {
+		families = append(families, f)
+	}
+	m.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// write writes f's HELP and TYPE lines and its series.
+func (f *metricFamily) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bucketLabels := slices.Concat(f.labels, []string{"le"})
+	for _, k := range keys {
+		s := f.series[k]
+		labels := formatLabels(f.labels, s.labelValues)
+		switch f.kind {
+		case "histogram":
+			var cumulative uint64
+			for i, upper := range f.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(bucketLabels, slices.Concat(s.labelValues, []string{formatFloat(upper)})), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(bucketLabels, slices.Concat(s.labelValues, []string{"+Inf"})), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatFloat(s.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, s.count)
+		default:
+			v := s.value
+			if s.fn != nil {
+				v = s.fn()
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatFloat(v))
+		}
+	}
+}
+
+// formatLabels renders {name="value",...}, or nothing without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Escapers for label values and HELP texts, as the exposition format requires.
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// formatFloat renders v as the exposition format expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// HandlerMetrics records RED metrics (rate, errors, duration) for Handlers
+// built with it through Config.Metrics or WithMetrics:
+//
+//   - mid_http_requests_total{route,method,status}
+//   - mid_http_request_duration_seconds{route,method}
+//   - mid_http_requests_in_flight{route,method}
+//   - mid_handler_failures_total{route,method,phase}, where phase is the Phase
+//     that failed, or "panic"
+//
+// route is the http.ServeMux pattern that matched, e.g. "POST /users/{id}".
+// method is one of the methods defined by net/http, or "other", so clients
+// sending made-up methods can't create new series.
+type HandlerMetrics struct {
+	requests *Counter
+	duration *Histogram
+	inFlight *Gauge
+	failures *Counter
+}
+
+// NewHandlerMetrics registers the Handler metrics with m.
+func NewHandlerMetrics(m *Metrics) *HandlerMetrics {
+	return &HandlerMetrics{
+		requests: m.Counter("mid_http_requests_total", "Requests served, by route, method and status.", "route", "method", "status"),
+		duration: m.Histogram("mid_http_request_duration_seconds", "Request latency in seconds, by route and method.", nil, "route", "method"),
+		inFlight: m.Gauge("mid_http_requests_in_flight", "Requests being served, by route and method.", "route", "method"),
+		failures: m.Counter("mid_handler_failures_total", "Failed requests, by route, method and the phase that failed.", "route", "method", "phase"),
+	}
+}
+
+// begin records a request starting and returns the func that records it
+// ending with the given status and failed phase ("" for none).
+func (hm *HandlerMetrics) begin(r *http.Request) func(status int, failed Phase) {
+	start := time.Now()
+	method := metricMethod(r.Method)
+	hm.inFlight.Add(1, r.Pattern, method)
+	return func(status int, failed Phase) {
+		hm.inFlight.Add(-1, r.Pattern, method)
+		hm.requests.Inc(r.Pattern, method, strconv.Itoa(status))
+		hm.duration.Observe(time.Since(start).Seconds(), r.Pattern, method)
+		if failed != "" {
+			hm.failures.Inc(r.Pattern, method, string(failed))
+		}
+	}
+}
+
+// metricMethod returns method when net/http defines it, and "other"
+// otherwise, bounding the method label's values.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// Instrument registers gauges reporting t's in-flight and waiting counts with
+// m, labelled with name to tell throttlers apart. ThrottlerOptions.Metrics
+// does the same at construction:
+//
+//   - mid_throttler_in_flight{throttler}
+//   - mid_throttler_waiting{throttler}
+func (t *Throttler) Instrument(m *Metrics, name string) {
+	m.Gauge("mid_throttler_in_flight", "Requests being served by the throttler.", "throttler").
+		Func(func() float64 { return float64(t.InFlight()) }, name)
+	m.Gauge("mid_throttler_waiting", "Requests queued by the throttler.", "throttler").
+		Func(func() float64 { return float64(t.Waiting()) }, name)
+}
@@ -0,0 +1,150 @@
+package mid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricsText checks the exposition format for each metric kind,
+// including label escaping and cumulative histogram buckets.
+func TestMetricsText(t *testing.T) {
+	m := NewMetrics()
+	m.Counter("jobs_total", "Jobs run.", "queue").Add(2, `a"b`)
+	m.Gauge("temperature", "Current temperature.").Set(-1.5)
+	m.Gauge("queue_length", "Queued jobs.").Func(func() float64 { return 7 })
+	h := m.Histogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `# HELP jobs_total Jobs run.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# HELP queue_length Queued jobs.
+# TYPE queue_length gauge
+queue_length 7
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature -1.5
+`
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+}
+
+// TestHandlerMetrics checks request counts by status, latency observations,
+// failure classes by phase, panics, and throttler gauges.
+func TestHandlerMetrics(t *testing.T) {
+	m := NewMetrics()
+	c := &Config{Metrics: NewHandlerMetrics(m)}
+
+	router := NewRouter()
+	router.POST("/users", HandlerWith(c, UserHandler, WithValidator(func(u User) error {
+		if u.Name == "" {
+			return errors.New("name required")
+		}
+		return nil
+	})))
+	router.POST("/fail", HandlerWith(c, UserHandlerWithError))
+	router.POST("/panic", HandlerWith(c, func(u User) (any, error) { panic("boom") }))
+
+	post := func(path, body string) {
+		defer func() { recover() }()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	}
+	post("/users", `{"Name":"John"}`)
+	post("/users", `{"Name":"John"}`)
+	post("/users", `{`)
+	post("/users", `{}`)
+	post("/fail", `{}`)
+	post("/panic", `{}`)
+
+	// made-up methods share one label value
+	mux := http.NewServeMux()
+	mux.Handle("/any", HandlerWith(c, UserHandler))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/any", strings.NewReader(`{}`)))
+
+	throttler := NewThrottler(ThrottlerOptions{Concurrency: 1, Timeout: time.Second})
+	throttler.Instrument(m, "api")
+
+	var text strings.Builder
+	m.WriteText(&text)
+	for _, line := range []string{
+		`mid_http_requests_total{route="POST /users",method="POST",status="200"} 2`,
+		`mid_http_requests_total{route="POST /users",method="POST",status="400"} 2`,
+		`mid_http_requests_total{route="POST /panic",method="POST",status="500"} 1`,
+		`mid_http_request_duration_seconds_count{route="POST /users",method="POST"} 4`,
+		`mid_http_requests_in_flight{route="POST /users",method="POST"} 0`,
+		`mid_handler_failures_total{route="POST /users",method="POST",phase="decode"} 1`,
+		`mid_handler_failures_total{route="POST /users",method="POST",phase="validate"} 1`,
+		`mid_handler_failures_total{route="POST /fail",method="POST",phase="handler"} 1`,
+		`mid_handler_failures_total{route="POST /panic",method="POST",phase="panic"} 1`,
+		`mid_http_requests_total{route="/any",method="other",status="200"} 1`,
+		`mid_throttler_in_flight{throttler="api"} 0`,
+		`mid_throttler_waiting{throttler="api"} 0`,
+	} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("expected %s in:\n%s", line, text.String())
+		}
+	}
+}
+
+// TestThrottlerMetrics verifies a throttler built with Metrics reports its
+// in-flight and queued requests as they change.
+func TestThrottlerMetrics(t *testing.T) {
+	m := NewMetrics()
+	throttler := NewThrottler(ThrottlerOptions{Concurrency: 1, Timeout: time.Second, Metrics: m, Name: "api"})
+	release := make(chan struct{})
+	handler := throttler.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+
+	gauges := func() string {
+		var text strings.Builder
+		m.WriteText(&text)
+		return text.String()
+	}
+	expect := func(inFlight, waiting int) {
+		t.Helper()
+		for _, line := range []string{
+			fmt.Sprintf(`mid_throttler_in_flight{throttler="api"} %d`, inFlight),
+			fmt.Sprintf(`mid_throttler_waiting{throttler="api"} %d`, waiting),
+		} {
+			if text := gauges(); !strings.Contains(text, line+"\n") {
+				t.Errorf("expected %s in:\n%s", line, text)
+			}
+		}
+	}
+
+	expect(0, 0)
+	done := make(chan struct{})
+	for range 2 {
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			done <- struct{}{}
+		}()
+	}
+	waitFor(t, func() bool { return throttler.InFlight() == 1 && throttler.Waiting() == 1 })
+	expect(1, 1)
+
+	close(release)
+	<-done
+	<-done
+	expect(0, 0)
+}
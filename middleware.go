@@ -9,40 +9,52 @@ import (
 	"time"
 )
 
+// Chain composes middleware following the func(http.Handler) http.Handler
+// convention into one, the first being the outermost:
+//
+//	stack := mid.Chain(mid.MaxBodySize(1<<20), mid.RequestThrottler(100, time.Second))
+//	mux.Handle("/users", stack(mid.Handler(createUser)))
+func Chain(middleware ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
 // InterruptContext listing for os.Signal (i.e. CTRL+C) to cancel a
 // context and end a server/daemon gracefully
 func InterruptContext() context.Context {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 
 	go func() {
-		<-quit
-		cancel()
+		sig := <-quit
+		// later signals are left to Serve, or to their default action
+		signal.Stop(quit)
+		cancel(interrupted{sig})
 	}()
 
 	return ctx
 }
 
+// interrupted is the cause of an InterruptContext's cancellation. Serve
+// receives the same signal, and uses it to tell that one from the next.
+type interrupted struct{ sig os.Signal }
+
+func (e interrupted) Error() string { return e.sig.String() + " signal received" }
+
 // RequestThrottler creates a re-usable limiter for multiple http.Handlers
 // If the server is too busy to handle the request within the timeout, then
-// a "503 Service Unavailable" status will be sent and the connection closed.
+// a "503 Service Unavailable" status with a Retry-After header is rendered
+// through the Defaults' ErrorRenderer. Use NewThrottler instead for queue
+// gauges (ThrottlerOptions.Metrics), priorities and a custom renderer:
+//
+//	mid.NewThrottler(mid.ThrottlerOptions{Concurrency: 100, Timeout: time.Second, Metrics: m}).Handler
 func RequestThrottler(concurrentRequests int, timeout time.Duration) func(http.Handler) http.Handler {
-	sema := make(chan struct{}, concurrentRequests)
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			select {
-			case sema <- struct{}{}:
-				defer func() { <-sema }() // release even if next panics
-				next.ServeHTTP(w, r)
-			case <-time.After(timeout):
-				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
-				return
-			case <-r.Context().Done():
-				return
-			}
-		})
-	}
+	return NewThrottler(ThrottlerOptions{Concurrency: concurrentRequests, Timeout: timeout}).Handler
 }
 
 // MaxBodySize limits the size of the request body to avoid a DOS with a large
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,23 @@ func TestHandlerWithMaxBodySizeExceeded(t *testing.T) {
 		t.Errorf("expected status 400 or 413, got %d: %s", recorder.Code, recorder.Body.String())
 	}
 }
+
+// TestChainOrder verifies Chain runs the first middleware outermost.
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := Chain(trace("a"), trace("b"), trace("c"))(Handler(UserHandler))
+	serve(handler, `{}`)
+
+	if strings.Join(order, ",") != "a,b,c" {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+}
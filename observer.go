@@ -0,0 +1,54 @@
+package mid
+
+import (
+	"net/http"
+	"time"
+)
+
+// Observer receives callbacks as a Handler moves through its phases, for
+// auditing, metrics or debugging without wrapping every HandlerFunc. Any
+// callback may be nil. Callbacks run synchronously on the request goroutine
+// and must not write to the response or modify the input.
+type Observer[T any] struct {
+	// OnDecoded runs once the input is hydrated from the query, the body and
+	// any `auth`/`claims` bindings, after normalization and before validation.
+	OnDecoded func(r *http.Request, input T)
+
+	// OnValidated runs once the normalized input has passed validation.
+	OnValidated func(r *http.Request, input T)
+
+	// OnResult runs after the HandlerFunc (inside any Interceptors) returns,
+	// with its result and how long it took.
+	OnResult func(r *http.Request, input T, response any, err error, d time.Duration)
+
+	// OnFailure runs when any phase before encoding fails, just before the
+	// error goes to the ErrorHandler.
+	OnFailure func(r *http.Request, input T, phase Phase, err error)
+
+	// OnEncodeError runs when the response can't be encoded. The status line
+	// has usually been sent, so the client sees a truncated response.
+	OnEncodeError func(r *http.Request, input T, response any, err error)
+}
+
+// observe dispatches the end of phase, which started at start and failed
+// with err if non-nil, to o's callbacks.
+func (o *Observer[T]) observe(r *http.Request, phase Phase, input T, response any, err error, start time.Time) {
+	switch {
+	case phase == PhaseHandler:
+		if o.OnResult != nil {
+			o.OnResult(r, input, response, err, time.Since(start))
+		}
+	case err != nil:
+	case phase == PhaseBind:
+		if o.OnDecoded != nil {
+			o.OnDecoded(r, input)
+		}
+	case phase == PhaseValidate:
+		if o.OnValidated != nil {
+			o.OnValidated(r, input)
+		}
+	}
+	if err != nil && o.OnFailure != nil {
+		o.OnFailure(r, input, phase, err)
+	}
+}
@@ -0,0 +1,68 @@
+package mid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestHandlerObserver checks which callbacks fire, in what order and with
+// what arguments, for successful and failing requests.
+func TestHandlerObserver(t *testing.T) {
+	var events []string
+	observer := Observer[RequiredUser]{
+		OnDecoded:   func(r *http.Request, u RequiredUser) { events = append(events, "decoded:"+u.Name) },
+		OnValidated: func(r *http.Request, u RequiredUser) { events = append(events, "validated:"+u.Name) },
+		OnResult: func(r *http.Request, u RequiredUser, resp any, err error, d time.Duration) {
+			if d < 0 {
+				t.Errorf("expected a non-negative duration, got %v", d)
+			}
+			events = append(events, fmt.Sprintf("result:%v:%v", resp, err))
+		},
+		OnFailure: func(r *http.Request, u RequiredUser, phase Phase, err error) {
+			events = append(events, "failure:"+string(phase))
+		},
+		OnEncodeError: func(r *http.Request, u RequiredUser, resp any, err error) {
+			events = append(events, "encode:"+err.Error())
+		},
+	}
+	second := Observer[RequiredUser]{OnDecoded: func(r *http.Request, u RequiredUser) { events = append(events, "second") }}
+
+	handlerErr := errors.New("boom")
+	h := Handler(func(u RequiredUser) (any, error) {
+		if u.Name == "fail" {
+			return nil, handlerErr
+		}
+		return u.Name, nil
+	}, WithObserver(observer), WithObserver(second))
+
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{`{"Name":"John"}`, []string{"decoded:John", "second", "validated:John", "result:John:<nil>"}},
+		{`{`, []string{"failure:decode"}},
+		{`{}`, []string{"decoded:", "second", "failure:validate"}},
+		{`{"Name":"fail"}`, []string{"decoded:fail", "second", "validated:fail", "result:<nil>:boom", "failure:handler"}},
+	}
+	for _, c := range cases {
+		events = nil
+		serve(h, c.body)
+		if !slices.Equal(events, c.want) {
+			t.Errorf("%s: expected events %v, got %v", c.body, c.want, events)
+		}
+	}
+
+	events = nil
+	h = Handler(func(u RequiredUser) (any, error) { return u, nil }, WithObserver(observer),
+		WithEncoder[RequiredUser](func(w http.ResponseWriter, r *http.Request, status int, v any) error {
+			return errors.New("broken pipe")
+		}))
+	serve(h, `{"Name":"John"}`)
+	if last := events[len(events)-1]; last != "encode:broken pipe" {
+		t.Errorf("expected OnEncodeError last, got %v", events)
+	}
+}
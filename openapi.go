@@ -0,0 +1,439 @@
+package mid
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIVersion is the OpenAPI specification version OpenAPI documents
+// declare.
+const OpenAPIVersion = "3.1.0"
+
+// Operation is the documentation attached to one registered route.
+type Operation struct {
+	Summary     string
+	Description string
+	OperationID string
+	Tags        []string
+
+	// Input overrides the input type reflected from the handler. Only its
+	// type is used; set it when the mid.Handler is hidden behind middleware.
+	Input any
+
+	// Output is a value of the response type, e.g. CreateUserResponse{}.
+	// Only its type is used. Leave nil for an undocumented response body.
+	Output any
+}
+
+// describer is implemented by the handlers Handler returns, exposing the input
+// type T to documentation tooling.
+type describer interface {
+	inputType() reflect.Type
+}
+
+// OpenAPI records registered handlers and renders them as an OpenAPI 3.1
+// document. It is an http.Handler serving that document as JSON, and is safe
+// for concurrent use.
+type OpenAPI struct {
+	Title       string
+	Version     string
+	Description string
+
+	mu  sync.Mutex
+	ops []openAPIRoute
+}
+
+// openAPIRoute is one Register call.
+type openAPIRoute struct {
+	method, path string
+	input        reflect.Type
+	op           Operation
+}
+
+// NewOpenAPI returns an empty document with the given API title and version.
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{Title: title, Version: version}
+}
+
+// Register documents h as serving method and path, then returns h unchanged so
+// registration can be inlined:
+//
+//	mux.Handle("POST /users", api.Register("POST", "/users", mid.Handler(createUser), mid.Operation{
+//		Summary: "Create a user",
+//		Output:  CreateUserResponse{},
+//	}))
+//
+// The input type is reflected from h, which must be a value returned by Handler
+// unless op.Input is set. path may use http.ServeMux wildcards such as {id}.
+func (d *OpenAPI) Register(method, path string, h http.Handler, op Operation) http.Handler {
+	var input reflect.Type
+	if op.Input != nil {
+		input = reflect.TypeOf(op.Input)
+	} else if desc, ok := h.(describer); ok {
+		input = desc.inputType()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ops = append(d.ops, openAPIRoute{method: strings.ToUpper(method), path: path, input: input, op: op})
+	return h
+}
+
+// Document builds the OpenAPI document for every route registered so far.
+func (d *OpenAPI) Document() map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := &schemaBuilder{components: map[string]any{}, names: map[reflect.Type]string{}, types: map[string]reflect.Type{}}
+	// error bodies are shared by every operation; naming them first keeps
+	// their component names stable
+	b.schema(reflect.TypeFor[JSONError]())
+	b.schema(reflect.TypeFor[ValidationErrors]())
+
+	paths := map[string]any{}
+	for _, route := range d.ops {
+		path, pathParams := openAPIPath(route.path)
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.method)] = b.operation(route, pathParams)
+	}
+
+	info := map[string]any{"title": d.Title, "version": d.Version}
+	if d.Description != "" {
+		info["description"] = d.Description
+	}
+	return map[string]any{
+		"openapi":    OpenAPIVersion,
+		"info":       info,
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.components},
+	}
+}
+
+// ServeHTTP writes the document as JSON.
+func (d *OpenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(d.Document()); err != nil {
+		Defaults().logger().ErrorContext(r.Context(), "mid: encode openapi", "err", err)
+	}
+}
+
+// patternWildcard matches http.ServeMux wildcards: {name}, {name...} and {$}.
+var patternWildcard = regexp.MustCompile(`\{([^}]*)\}`)
+
+// openAPIPath converts a ServeMux path pattern into an OpenAPI path template
+// and lists its path parameters.
+func openAPIPath(pattern string) (string, []string) {
+	var params []string
+	path := patternWildcard.ReplaceAllStringFunc(pattern, func(m string) string {
+		name := strings.TrimSuffix(m[1:len(m)-1], "...")
+		if name == "$" {
+			return ""
+		}
+		params = append(params, name)
+		return "{" + name + "}"
+	})
+	return path, params
+}
+
+// schemaBuilder reflects Go types into JSON Schemas, collecting named structs
+// into components so they are emitted once and referenced by $ref.
+type schemaBuilder struct {
+	components map[string]any
+	names      map[reflect.Type]string // component name of each named struct
+	types      map[string]reflect.Type // and the type each name is taken by
+}
+
+// Component names may only hold these characters; importPaths matches the
+// import paths reflect spells out in type arguments.
+var (
+	invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	importPaths           = regexp.MustCompile(`[^\[\],\s*]*/`)
+)
+
+// componentName returns the component name for the named struct t: its
+// package-qualified name, e.g. "mid.JSONError" or "api.Page_api.User" for an
+// instance of a generic type, with a numeric suffix when another type with
+// the same name already took it.
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	base := importPaths.ReplaceAllString(t.String(), "")
+	base = strings.Trim(invalidComponentChars.ReplaceAllString(base, "_"), "_")
+	name := base
+	for i := 2; b.types[name] != nil; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	b.names[t], b.types[name] = name, t
+	return name
+}
+
+// operation builds the OpenAPI Operation Object for route.
+func (b *schemaBuilder) operation(route openAPIRoute, pathParams []string) map[string]any {
+	op := map[string]any{}
+	if route.op.Summary != "" {
+		op["summary"] = route.op.Summary
+	}
+	if route.op.Description != "" {
+		op["description"] = route.op.Description
+	}
+	if route.op.OperationID != "" {
+		op["operationId"] = route.op.OperationID
+	}
+	if len(route.op.Tags) > 0 {
+		op["tags"] = route.op.Tags
+	}
+
+	var params []any
+	for _, name := range pathParams {
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+
+	if input := derefType(route.input); input != nil && input.Kind() == reflect.Struct {
+		for _, f := range scanFields(input, FieldQuery) {
+			field := input.Field(f.Index)
+			schema := b.schema(field.Type)
+			required := applyValidateRules(schema, field.Type, field.Tag.Get("validate"))
+			params = append(params, map[string]any{
+				"name": f.Tag, "in": "query", "required": required, "schema": schema,
+			})
+		}
+
+		switch route.method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			// these methods don't carry a request body
+		default:
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": b.schema(input)}},
+			}
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	ok := map[string]any{"description": "OK"}
+	if route.op.Output != nil {
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(route.op.Output))}}
+	}
+	op["responses"] = map[string]any{
+		"200": ok,
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+				"oneOf": []any{
+					b.schema(reflect.TypeFor[JSONError]()),
+					b.schema(reflect.TypeFor[ValidationErrors]()),
+				},
+			}}},
+		},
+	}
+	return op
+}
+
+// derefType strips pointer indirections from t.
+func derefType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schema reflects t into a JSON Schema.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	t = derefType(t)
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := b.componentName(t)
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = map[string]any{} // placeholder for recursive types
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{} // interfaces and the like accept anything
+	}
+}
+
+// structSchema reflects a struct's JSON-visible fields into an object schema,
+// translating `validate` rules into schema keywords.
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	b.collectFields(t, props, &required)
+
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// collectFields adds t's fields to props, flattening embedded structs the way
+// encoding/json does.
+func (b *schemaBuilder) collectFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if _, ok := field.Tag.Lookup(FieldAuth); ok || field.Tag.Get(FieldClaims) != "" {
+			continue // bound from the request context, never sent by clients
+		}
+		if field.Tag.Get(FieldQuery) != "" {
+			continue // documented as a query parameter, not part of the body
+		}
+
+		if field.Anonymous && name == "" && derefType(field.Type).Kind() == reflect.Struct {
+			b.collectFields(derefType(field.Type), props, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schema(field.Type)
+		if applyValidateRules(schema, field.Type, field.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		props[name] = schema
+	}
+}
+
+// applyValidateRules maps go-playground `validate` rules onto schema keywords
+// and reports whether the field is required. Rules after "dive" describe the
+// elements of a slice and are applied to its items schema.
+func applyValidateRules(schema map[string]any, t reflect.Type, rules string) bool {
+	t = derefType(t)
+	required := false
+
+	for i, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "dive":
+			if items, ok := schema["items"].(map[string]any); ok {
+				rest := strings.Join(strings.Split(rules, ",")[i+1:], ",")
+				applyValidateRules(items, t.Elem(), rest)
+			}
+			return required
+		case "min", "gte":
+			setBound(schema, t, param, "minLength", "minimum", "minItems")
+		case "max", "lte":
+			setBound(schema, t, param, "maxLength", "maximum", "maxItems")
+		case "gt":
+			setBound(schema, t, param, "", "exclusiveMinimum", "")
+		case "lt":
+			setBound(schema, t, param, "", "exclusiveMaximum", "")
+		case "len":
+			setBound(schema, t, param, "minLength", "", "minItems")
+			setBound(schema, t, param, "maxLength", "", "maxItems")
+		case "oneof":
+			var enum []any
+			for _, v := range strings.Fields(param) {
+				enum = append(enum, schemaLiteral(t, v))
+			}
+			schema["enum"] = enum
+		case "email":
+			schema["format"] = "email"
+		case "url", "uri", "http_url":
+			schema["format"] = "uri"
+		case "uuid", "uuid4":
+			schema["format"] = "uuid"
+		case "ip":
+			// either family; there is no single format for both
+			schema["anyOf"] = []any{map[string]any{"format": "ipv4"}, map[string]any{"format": "ipv6"}}
+		case "ipv4", "ipv6", "hostname", "datetime":
+			schema["format"] = map[string]string{
+				"ipv4": "ipv4", "ipv6": "ipv6", "hostname": "hostname", "datetime": "date-time",
+			}[name]
+		}
+	}
+	return required
+}
+
+// setBound sets the keyword matching t's kind (string length, number value,
+// array length or map size) to param. An empty keyword means the rule doesn't
+// apply.
+func setBound(schema map[string]any, t reflect.Type, param, strKey, numKey, collKey string) {
+	key := ""
+	switch t.Kind() {
+	case reflect.String:
+		key = strKey
+	case reflect.Slice, reflect.Array:
+		key = collKey
+	case reflect.Map:
+		if collKey != "" {
+			key = strings.TrimSuffix(collKey, "Items") + "Properties" // minProperties/maxProperties
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		key = numKey
+	}
+	if key == "" {
+		return
+	}
+	if n, err := strconv.ParseFloat(param, 64); err == nil {
+		schema[key] = n
+	}
+}
+
+// schemaLiteral converts a `oneof` value to a JSON value of t's kind, keeping
+// it as a string when it isn't numeric.
+func schemaLiteral(t reflect.Type, v string) any {
+	if t.Kind() != reflect.String {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package mid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+type CreateWidget struct {
+	DryRun bool     `json:"-" query:"dry_run"`
+	Name   string   `json:"name" validate:"required,min=3,max=40"`
+	Kind   string   `json:"kind" validate:"oneof=small large"`
+	Count  int      `json:"count" validate:"gte=1,lte=10"`
+	Owner  string   `json:"owner,omitempty" validate:"email"`
+	Labels []string `json:"labels" validate:"max=5,dive,min=2"`
+}
+
+type WidgetResponse struct {
+	ID int `json:"id"`
+}
+
+// TestOpenAPIDocument verifies a registered Handler is reflected into an
+// operation with query parameters, a request body schema carrying the
+// translated validate rules, and a referenced response schema.
+func TestOpenAPIDocument(t *testing.T) {
+	api := NewOpenAPI("Widgets", "1.0.0")
+	h := Handler(func(in CreateWidget) (any, error) { return WidgetResponse{ID: 1}, nil })
+	if got := api.Register(http.MethodPost, "/teams/{team}/widgets", h, Operation{
+		Summary: "Create a widget",
+		Output:  WidgetResponse{},
+	}); got != h {
+		t.Fatal("expected Register to return the handler unchanged")
+	}
+
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Summary    string `json:"summary"`
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]string `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != OpenAPIVersion {
+		t.Errorf("unexpected openapi version %q", doc.OpenAPI)
+	}
+	op, ok := doc.Paths["/teams/{team}/widgets"]["post"]
+	if !ok {
+		t.Fatalf("expected a post operation, got %v", doc.Paths)
+	}
+	if op.Summary != "Create a widget" {
+		t.Errorf("unexpected summary %q", op.Summary)
+	}
+	if len(op.Parameters) != 2 || op.Parameters[0].In != "path" || op.Parameters[1].Name != "dry_run" {
+		t.Errorf("unexpected parameters %+v", op.Parameters)
+	}
+	if ref := op.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/mid.CreateWidget" {
+		t.Errorf("unexpected request body schema %q", ref)
+	}
+
+	want := `{"properties":{` +
+		`"count":{"format":"int64","maximum":10,"minimum":1,"type":"integer"},` +
+		`"kind":{"enum":["small","large"],"type":"string"},` +
+		`"labels":{"items":{"minLength":2,"type":"string"},"maxItems":5,"type":"array"},` +
+		`"name":{"maxLength":40,"minLength":3,"type":"string"},` +
+		`"owner":{"format":"email","type":"string"}},` +
+		`"required":["name"],"type":"object"}`
+	if got := string(doc.Components.Schemas["mid.CreateWidget"]); got != want {
+		t.Errorf("unexpected CreateWidget schema:\n%s", got)
+	}
+	if _, ok := doc.Components.Schemas["mid.WidgetResponse"]; !ok {
+		t.Error("expected the declared output type in components")
+	}
+}
+
+type Page[T any] struct {
+	Items []T `json:"items"`
+}
+
+// TestOpenAPIComponentNames verifies components are package-qualified, that
+// generic instances get distinct names, and that same-named types, including
+// one named like a built-in error body, don't overwrite each other.
+func TestOpenAPIComponentNames(t *testing.T) {
+	type JSONError struct {
+		Code int `json:"code"`
+	}
+	type Address struct {
+		IP string `json:"ip" validate:"ip"`
+	}
+	first := reflect.TypeFor[Address]()
+	second := func() reflect.Type {
+		type Address struct {
+			Street string `json:"street"`
+		}
+		return reflect.TypeFor[Address]()
+	}()
+
+	b := &schemaBuilder{components: map[string]any{}, names: map[reflect.Type]string{}, types: map[string]reflect.Type{}}
+	refs := []string{}
+	for _, typ := range []reflect.Type{
+		reflect.TypeFor[JSONError](),
+		reflect.TypeFor[Page[WidgetResponse]](),
+		reflect.TypeFor[Page[CreateWidget]](),
+		first,
+		second,
+	} {
+		refs = append(refs, b.schema(typ)["$ref"].(string))
+	}
+	want := []string{
+		"#/components/schemas/mid.JSONError",
+		"#/components/schemas/mid.Page_mid.WidgetResponse",
+		"#/components/schemas/mid.Page_mid.CreateWidget",
+		"#/components/schemas/mid.Address",
+		"#/components/schemas/mid.Address_2",
+	}
+	if !slices.Equal(refs, want) {
+		t.Errorf("expected refs %v, got %v", want, refs)
+	}
+	if got := b.components["mid.Address"].(map[string]any)["properties"].(map[string]any)["ip"].(map[string]any); got["anyOf"] == nil || got["format"] != nil {
+		t.Errorf("expected ip to allow either address family, got %v", got)
+	}
+
+	// in a document, the built-in error body keeps its name
+	api := NewOpenAPI("Errors", "1.0.0")
+	api.Register(http.MethodPost, "/errors", Handler(func(in JSONError) (any, error) { return nil, nil }), Operation{})
+	schemas := api.Document()["components"].(map[string]any)["schemas"].(map[string]any)
+	if _, ok := schemas["mid.JSONError_2"]; !ok || len(schemas["mid.JSONError"].(map[string]any)["properties"].(map[string]any)) != 2 {
+		t.Errorf("expected the user's JSONError beside the built-in one, got %v", schemas)
+	}
+}
+
+type SearchWidgets struct {
+	Page   int            `json:"page" query:"page" validate:"required,gte=1"`
+	Filter string         `json:"filter" validate:"required"`
+	Meta   map[string]int `json:"meta" validate:"min=1,max=3"`
+}
+
+// TestOpenAPIQueryFields verifies query-bound fields are documented only as
+// parameters, not as body properties, and that map bounds count properties.
+func TestOpenAPIQueryFields(t *testing.T) {
+	api := NewOpenAPI("Widgets", "1.0.0")
+	api.Register(http.MethodPost, "/widgets/search", Handler(func(in SearchWidgets) (any, error) { return nil, nil }), Operation{})
+
+	doc := api.Document()
+	op := doc["paths"].(map[string]any)["/widgets/search"].(map[string]any)["post"].(map[string]any)
+	params := op["parameters"].([]any)
+	if len(params) != 1 || params[0].(map[string]any)["name"] != "page" || params[0].(map[string]any)["required"] != true {
+		t.Errorf("unexpected parameters %v", params)
+	}
+
+	got, err := json.Marshal(doc["components"].(map[string]any)["schemas"].(map[string]any)["mid.SearchWidgets"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"properties":{` +
+		`"filter":{"type":"string"},` +
+		`"meta":{"additionalProperties":{"format":"int64","type":"integer"},"maxProperties":3,"minProperties":1,"type":"object"}},` +
+		`"required":["filter"],"type":"object"}`
+	if string(got) != want {
+		t.Errorf("unexpected SearchWidgets schema:\n%s", got)
+	}
+}
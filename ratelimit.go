@@ -0,0 +1,174 @@
+package mid
+
+import (
+	"container/list"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is rendered, wrapped in a 429 HTTPError, when a client has
+// exhausted its token bucket.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	Rate  float64 // tokens added per second
+	Burst int     // bucket capacity; defaults to 1
+
+	// Key groups requests into buckets; it defaults to KeyByIP. Requests with
+	// an empty key are not limited.
+	Key func(r *http.Request) string
+
+	// MaxKeys bounds the buckets kept in memory; it defaults to 10000. Once
+	// it is reached, a new key evicts the least recently used bucket, so
+	// rotating keys can't lock new clients out. Size it above the number of
+	// clients active within IdleTTL, as an evicted client starts over with a
+	// full bucket.
+	MaxKeys int
+
+	IdleTTL time.Duration // buckets idle this long are dropped; defaults to the time to refill a full bucket
+
+	OnError ErrorRenderer // renders the 429; defaults to the Defaults' ErrorRenderer
+
+	// Now returns the current time; it defaults to time.Now and exists so
+	// tests can use a fixed clock.
+	Now func() time.Time
+}
+
+// KeyByIP keys requests by the host part of r.RemoteAddr. Behind a proxy, put
+// middleware that rewrites RemoteAddr from a trusted header in front of it.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader keys requests by the value of the named header, e.g. an API key.
+func KeyByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByPrincipal keys requests by the authenticated principal's stable ID: the
+// subject of Claims, a string principal, or the PrincipalID of an Identity.
+// Anonymous requests, and principals without an ID, fall back to KeyByIP
+// rather than sharing one bucket. Place RateLimit after RequireAuth or
+// JWTAuth.
+func KeyByPrincipal(r *http.Request) string {
+	p, _ := PrincipalFrom(r.Context())
+	if id := principalID(p); id != "" {
+		return "principal:" + id
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// tokenBucket is one client's bucket. tokens is as of last.
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit limits each client, as grouped by opts.Key, to opts.Rate requests
+// per second with bursts of up to opts.Burst. Every response carries
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers; rejected
+// requests get a 429 with Retry-After, rendered through opts.OnError.
+func RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.Rate <= 0 {
+		panic("mid: RateLimit requires a positive Rate")
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.MaxKeys < 1 {
+		opts.MaxKeys = 10000
+	}
+	if opts.IdleTTL <= 0 {
+		opts.IdleTTL = time.Duration(float64(opts.Burst) / opts.Rate * float64(time.Second))
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	var (
+		mu      sync.Mutex
+		lru     = list.New() // front is most recently used
+		buckets = map[string]*list.Element{}
+	)
+
+	// take refills key's bucket and tries to spend a token. It returns the
+	// tokens left and, when rejected, how long until one is available.
+	take := func(key string, now time.Time) (ok bool, remaining float64, wait time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// drop idle buckets from the cold end of the list
+		for e := lru.Back(); e != nil && now.Sub(e.Value.(*tokenBucket).last) > opts.IdleTTL; e = lru.Back() {
+			delete(buckets, e.Value.(*tokenBucket).key)
+			lru.Remove(e)
+		}
+
+		var b *tokenBucket
+		if e, found := buckets[key]; found {
+			lru.MoveToFront(e)
+			b = e.Value.(*tokenBucket)
+			b.tokens = math.Min(float64(opts.Burst), b.tokens+now.Sub(b.last).Seconds()*opts.Rate)
+			b.last = now
+		} else {
+			if lru.Len() >= opts.MaxKeys {
+				oldest := lru.Back()
+				delete(buckets, oldest.Value.(*tokenBucket).key)
+				lru.Remove(oldest)
+			}
+			b = &tokenBucket{key: key, tokens: float64(opts.Burst), last: now}
+			buckets[key] = lru.PushFront(b)
+		}
+
+		if b.tokens < 1 {
+			return false, b.tokens, time.Duration((1 - b.tokens) / opts.Rate * float64(time.Second))
+		}
+		b.tokens--
+		return true, b.tokens, 0
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, remaining, wait := take(key, opts.Now())
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(opts.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds((float64(opts.Burst)-remaining)/opts.Rate)))
+
+			if !ok {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(wait.Seconds())))
+				renderError(opts.OnError, w, r, NewHTTPError(http.StatusTooManyRequests, ErrRateLimited))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds rounds a duration in seconds up to a whole number for headers
+// that only accept integers.
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
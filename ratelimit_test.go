@@ -0,0 +1,132 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRateLimit covers per-key buckets, the RateLimit-* and Retry-After
+// headers, refill over time, and the JSON 429 body.
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	limit := RateLimit(RateLimitOptions{
+		Rate:  1,
+		Burst: 2,
+		Key:   KeyByHeader("X-API-Key"),
+		Now:   func() time.Time { return now },
+	})
+	handler := limit(Handler(UserHandler))
+
+	call := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(`{}`))
+		request.Header.Set("X-API-Key", key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		recorder := call("a")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusOK, recorder.Code)
+		}
+		if got := recorder.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: expected remaining %s, got %s", i, wantRemaining, got)
+		}
+	}
+
+	recorder := call("a")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, recorder.Code)
+	}
+	if recorder.Body.String() != `{"error":"rate limit exceeded"}`+"\n" {
+		t.Errorf("unexpected response: %s", recorder.Body.String())
+	}
+	if got := recorder.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+	if got := recorder.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("expected RateLimit-Limit 2, got %q", got)
+	}
+
+	// another client has its own bucket
+	if code := call("b").Code; code != http.StatusOK {
+		t.Errorf("expected a separate bucket for another key, got %d", code)
+	}
+
+	// one token refills after a second
+	now = now.Add(time.Second)
+	if code := call("a").Code; code != http.StatusOK {
+		t.Errorf("expected a refilled token, got %d", code)
+	}
+}
+
+// TestRateLimitEviction verifies MaxKeys bounds memory by evicting the least
+// recently used bucket, so a full table never refuses new keys.
+func TestRateLimitEviction(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limit := RateLimit(RateLimitOptions{
+		Rate: 1, Burst: 1, MaxKeys: 1, IdleTTL: time.Hour,
+		Key: KeyByHeader("X-API-Key"),
+		Now: func() time.Time { return now },
+	})
+	handler := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	call := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-API-Key", key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	call("a")
+	if code := call("a").Code; code != http.StatusTooManyRequests {
+		t.Fatalf("expected a to be limited, got %d", code)
+	}
+
+	// the table is full and a hasn't refilled, yet a new key still gets its
+	// burst by evicting the least recently used bucket
+	if code := call("b").Code; code != http.StatusOK {
+		t.Errorf("expected b to evict a's bucket, got %d", code)
+	}
+	if code := call("b").Code; code != http.StatusTooManyRequests {
+		t.Errorf("expected b to be limited, got %d", code)
+	}
+}
+
+// TestKeyByPrincipal verifies principals are keyed by a stable ID, and that
+// those without one fall back to the client IP.
+func TestKeyByPrincipal(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal any
+		want      string
+	}{
+		{"anonymous", nil, "ip:192.0.2.1"},
+		{"claims", Claims{"sub": "user-1"}, "principal:user-1"},
+		{"claimsWithoutSubject", Claims{"scope": "read"}, "ip:192.0.2.1"},
+		{"string", "ada", "principal:ada"},
+		{"identity", testIdentity("user-2"), "principal:user-2"},
+		{"pointer", &Account{ID: "user-3"}, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = "192.0.2.1:1234"
+			if tt.principal != nil {
+				request = request.WithContext(ContextWithPrincipal(request.Context(), tt.principal))
+			}
+			if got := KeyByPrincipal(request); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type testIdentity string
+
+func (id testIdentity) PrincipalID() string { return string(id) }
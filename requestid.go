@@ -0,0 +1,134 @@
+package mid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDOptions configures RequestID.
+type RequestIDOptions struct {
+	Header string // defaults to X-Request-ID
+
+	// Trust reports whether r's incoming ID may be used, e.g. because r came
+	// through a known proxy. When nil, incoming IDs are ignored and one is
+	// always generated, so clients can't choose the IDs in your logs.
+	Trust func(r *http.Request) bool
+
+	MaxLength int           // longest incoming ID accepted; defaults to 128
+	Generate  func() string // defaults to 32 random hex characters
+}
+
+// requestIDKey is the context key RequestID stores the ID under.
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID stored by RequestID, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID gives every request an ID for correlating responses with logs.
+// A trusted, well-formed incoming ID is kept; otherwise a new one is
+// generated. The ID is echoed in the response header and stored in the
+// context, where JSONErrorRenderer adds it to error bodies and loggers
+// wrapped by RequestIDLogHandler (including the one Handler logs to) attach
+// it to records.
+func RequestID(opts RequestIDOptions) func(http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+	if opts.MaxLength < 1 {
+		opts.MaxLength = 128
+	}
+	if opts.Generate == nil {
+		opts.Generate = newRequestID
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(opts.Header)
+			if opts.Trust == nil || !opts.Trust(r) || !validRequestID(id, opts.MaxLength) {
+				id = opts.Generate()
+			}
+			w.Header().Set(opts.Header, id)
+			next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// validRequestID reports whether id is non-empty, at most max bytes and made
+// only of characters safe to echo in headers and logs.
+func validRequestID(id string, max int) bool {
+	if id == "" || len(id) > max {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 128 random bits as hex.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIDLogHandler wraps h so records logged with a context carrying a
+// request ID get a request_id attribute:
+//
+//	logger := slog.New(mid.RequestIDLogHandler(slog.NewJSONHandler(os.Stderr, nil)))
+//	logger.InfoContext(r.Context(), "user created")
+func RequestIDLogHandler(h slog.Handler) slog.Handler {
+	if _, ok := h.(requestIDLogHandler); ok {
+		return h
+	}
+	return requestIDLogHandler{h}
+}
+
+// loggerWithRequestID returns l with its handler wrapped by
+// RequestIDLogHandler.
+func loggerWithRequestID(l *slog.Logger) *slog.Logger {
+	if _, ok := l.Handler().(requestIDLogHandler); ok {
+		return l
+	}
+	return slog.New(requestIDLogHandler{l.Handler()})
+}
+
+// requestIDLogHandler is the slog.Handler returned by RequestIDLogHandler.
+type requestIDLogHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request ID from ctx, if any, before passing r on.
+func (h requestIDLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFrom(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps the wrapper around the derived handler.
+func (h requestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the wrapper around the derived handler.
+func (h requestIDLogHandler) WithGroup(name string) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,91 @@
+package mid
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequestID covers accepting a valid incoming ID from a trusted request,
+// replacing malformed or untrusted ones, echoing it, and its appearance in
+// error bodies and logs.
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := Handler(UserHandlerWithError, WithLogger[User](logger))
+
+	var seen string
+	capture := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestIDFrom(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	}
+	trusted := RequestIDOptions{Trust: func(r *http.Request) bool { return true }}
+	stack := Chain(RequestID(trusted), capture)
+
+	tests := []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{"valid", "req-123_abc", true},
+		{"missing", "", false},
+		{"bad characters", "req 123\n", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/user", strings.NewReader(`{}`))
+			if tt.incoming != "" {
+				request.Header.Set("X-Request-ID", tt.incoming)
+			}
+			recorder := httptest.NewRecorder()
+			stack(h).ServeHTTP(recorder, request)
+
+			id := recorder.Header().Get("X-Request-ID")
+			if tt.kept && id != tt.incoming {
+				t.Errorf("expected the incoming ID %q to be kept, got %q", tt.incoming, id)
+			}
+			if !tt.kept && (id == tt.incoming || len(id) != 32) {
+				t.Errorf("expected a generated ID, got %q", id)
+			}
+			if seen != id {
+				t.Errorf("expected the context to carry %q, got %q", id, seen)
+			}
+			if !strings.Contains(recorder.Body.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("expected the error body to include the ID, got %q", recorder.Body.String())
+			}
+		})
+	}
+
+	// without Trust, and for untrusted requests, a fresh ID is always used
+	for name, opts := range map[string]RequestIDOptions{
+		"default":   {},
+		"untrusted": {Trust: func(r *http.Request) bool { return false }},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-Request-ID", "spoofed")
+		recorder := httptest.NewRecorder()
+		RequestID(opts)(http.NotFoundHandler()).ServeHTTP(recorder, request)
+		if id := recorder.Header().Get("X-Request-ID"); id == "spoofed" || id == "" {
+			t.Errorf("%s: expected the incoming ID to be replaced, got %q", name, id)
+		}
+	}
+
+	// the Handler's logger attaches the ID
+	logs.Reset()
+	request := httptest.NewRequest(http.MethodGet, "/user", strings.NewReader(`{}`))
+	request.Header.Set("X-Request-ID", "log-me")
+	RequestID(trusted)(Handler(UserHandler, WithLogger[User](logger),
+		WithEncoder[User](func(w http.ResponseWriter, r *http.Request, status int, v any) error {
+			return errors.New("broken pipe")
+		}))).ServeHTTP(httptest.NewRecorder(), request)
+	if !strings.Contains(logs.String(), "request_id=log-me") {
+		t.Errorf("expected the log record to carry the request ID, got %q", logs.String())
+	}
+}
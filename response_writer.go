@@ -0,0 +1,176 @@
+package mid
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps an http.ResponseWriter to record the status and the
+// number of body bytes written, for middleware such as AccessLog. Flush and
+// Hijack pass through to the wrapped writer, and Unwrap lets
+// http.ResponseController reach it for everything else. Hand next handlers
+// Writer rather than the ResponseWriter itself, so they see http.Flusher and
+// http.Hijacker only when the wrapped writer supports them:
+//
+//	rw := mid.WrapResponseWriter(w)
+//	next.ServeHTTP(rw.Writer(), r)
+//	log.Println(rw.Status())
+type ResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WrapResponseWriter returns w wrapped in a ResponseWriter, or the existing
+// ResponseWriter when w is one or its Writer, so stacked middleware share a
+// single wrapper.
+func WrapResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if n, ok := w.(interface{ exposed() exposableWriter }); ok {
+		if rw, ok := n.exposed().(*ResponseWriter); ok {
+			return rw
+		}
+	}
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// Writer returns w as an http.ResponseWriter implementing http.Flusher and
+// http.Hijacker exactly when the wrapped writer does, for passing on to the
+// next handler.
+func (w *ResponseWriter) Writer() http.ResponseWriter {
+	return exposeOptional(w, w.ResponseWriter)
+}
+
+// WriteHeader records status before passing it on. Informational (1xx)
+// statuses other than 101 Switching Protocols are passed on without being
+// recorded, since the final status is still to come.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts b and implies a 200 status when none was written.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the status written so far, or 200 if nothing was written
+// (net/http's implicit status).
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Written reports whether the status line has been sent.
+func (w *ResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+// BytesWritten returns the number of body bytes written.
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytes
+}
+
+// FlushError is called by http.ResponseController's Flush. It flushes the
+// wrapped writer, failing with http.ErrNotSupported when it can't, and
+// records the implied 200 status.
+func (w *ResponseWriter) FlushError() error {
+	err := http.NewResponseController(w.ResponseWriter).Flush()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return err
+}
+
+// Flush implements http.Flusher. It is a no-op when the wrapped writer can't
+// flush.
+func (w *ResponseWriter) Flush() {
+	w.FlushError()
+}
+
+// Hijack implements http.Hijacker, failing with http.ErrNotSupported when the
+// wrapped writer can't hijack. A hijacked connection is recorded as 101
+// Switching Protocols unless a status was already written.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// exposableWriter is a wrapper such as ResponseWriter that implements every
+// optional interface by passing it through, whether or not the writer it
+// wraps supports it.
+type exposableWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	Unwrap() http.ResponseWriter
+}
+
+// exposeOptional returns w narrowed to the optional interfaces base
+// implements, so handlers that type-assert http.Flusher or http.Hijacker get
+// an honest answer. base is the writer w ultimately writes to.
+func exposeOptional(w exposableWriter, base http.ResponseWriter) http.ResponseWriter {
+	_, flusher := base.(http.Flusher)
+	_, hijacker := base.(http.Hijacker)
+	n := narrowWriter{w}
+	switch {
+	case flusher && hijacker:
+		return flushHijackWriter{n, w, w}
+	case flusher:
+		return flushWriter{n, w}
+	case hijacker:
+		return hijackWriter{n, w}
+	default:
+		return n
+	}
+}
+
+// narrowWriter exposes only the http.ResponseWriter methods and Unwrap of the
+// writer it holds; the types below add back the optional interfaces.
+type narrowWriter struct {
+	w exposableWriter
+}
+
+func (n narrowWriter) Header() http.Header         { return n.w.Header() }
+func (n narrowWriter) Write(b []byte) (int, error) { return n.w.Write(b) }
+func (n narrowWriter) WriteHeader(status int)      { n.w.WriteHeader(status) }
+func (n narrowWriter) Unwrap() http.ResponseWriter { return n.w }
+
+// exposed returns the writer exposeOptional narrowed.
+func (n narrowWriter) exposed() exposableWriter { return n.w }
+
+type flushWriter struct {
+	narrowWriter
+	http.Flusher
+}
+
+type hijackWriter struct {
+	narrowWriter
+	http.Hijacker
+}
+
+type flushHijackWriter struct {
+	narrowWriter
+	http.Flusher
+	http.Hijacker
+}
@@ -0,0 +1,150 @@
+package mid
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound and ErrMethodNotAllowed are the errors a Router renders, wrapped
+// in an HTTPError carrying the matching status, for unknown paths and for
+// known paths requested with an unregistered method.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+)
+
+// Router registers handlers on an http.ServeMux by method and path, with
+// groups sharing a path prefix and a middleware chain. Unlike a bare ServeMux,
+// 404 and 405 responses are rendered through OnError (the Defaults'
+// ErrorRenderer when unset), 405s carry an Allow header, and OPTIONS requests
+// to a known path are answered automatically. These responses go through
+// middleware like any route: those for a known path through the middleware of
+// the Router that first registered it, and 404s through the root's.
+type Router struct {
+	// OnError renders 404 and 405 responses. It is read from the root Router,
+	// so set it before serving; groups share their root's renderer.
+	OnError ErrorRenderer
+
+	root       *Router
+	prefix     string
+	middleware []func(http.Handler) http.Handler
+
+	// shared by the root and every group
+	mux       *http.ServeMux
+	mu        sync.RWMutex
+	methods   map[string][]string // path -> registered methods
+	unmatched http.Handler        // fallback inside the root's middleware, for 404s
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	r := &Router{mux: http.NewServeMux(), methods: map[string][]string{}}
+	r.root = r
+	r.unmatched = http.HandlerFunc(r.fallback)
+	r.mux.Handle("/", http.HandlerFunc(r.notFound))
+	return r
+}
+
+// Use appends middleware to the chain applied to routes registered on r (and
+// on groups created from r) afterwards. The first middleware is the outermost.
+// On the root Router, it also applies to 404 responses straight away.
+func (r *Router) Use(middleware ...func(http.Handler) http.Handler) {
+	r.root.mu.Lock()
+	defer r.root.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+	if r == r.root {
+		r.unmatched = Chain(r.middleware...)(http.HandlerFunc(r.fallback))
+	}
+}
+
+// Group returns a Router whose routes are registered below prefix and wrapped
+// in r's middleware followed by middleware.
+func (r *Router) Group(prefix string, middleware ...func(http.Handler) http.Handler) *Router {
+	return &Router{
+		root:       r.root,
+		prefix:     r.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: slices.Concat(r.middleware, middleware),
+	}
+}
+
+// Handle registers h for method and path, which may use http.ServeMux
+// wildcards such as {id}. Registering GET also serves HEAD, as ServeMux does.
+func (r *Router) Handle(method, path string, h http.Handler) {
+	root := r.root
+	full := r.prefix + path
+
+	root.mu.Lock()
+	defer root.mu.Unlock()
+
+	chain := Chain(r.middleware...)
+	h = chain(h)
+
+	// the first method on a path also claims the method-less pattern, which
+	// ServeMux only reaches when no method-specific pattern matched
+	if _, ok := root.methods[full]; !ok && full != "/" {
+		root.mux.Handle(full, chain(http.HandlerFunc(root.fallback)))
+	}
+	root.methods[full] = append(root.methods[full], method)
+	root.mux.Handle(method+" "+full, h)
+}
+
+// GET registers h for GET (and HEAD) requests to path.
+func (r *Router) GET(path string, h http.Handler) { r.Handle(http.MethodGet, path, h) }
+
+// POST registers h for POST requests to path.
+func (r *Router) POST(path string, h http.Handler) { r.Handle(http.MethodPost, path, h) }
+
+// PUT registers h for PUT requests to path.
+func (r *Router) PUT(path string, h http.Handler) { r.Handle(http.MethodPut, path, h) }
+
+// PATCH registers h for PATCH requests to path.
+func (r *Router) PATCH(path string, h http.Handler) { r.Handle(http.MethodPatch, path, h) }
+
+// DELETE registers h for DELETE requests to path.
+func (r *Router) DELETE(path string, h http.Handler) { r.Handle(http.MethodDelete, path, h) }
+
+// ServeHTTP dispatches the request to the matching handler.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.root.mux.ServeHTTP(w, req)
+}
+
+// notFound serves requests matching no registered path, and those to "/"
+// matching none of its methods, through the root's current middleware.
+func (r *Router) notFound(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	h := r.unmatched
+	r.mu.RUnlock()
+	h.ServeHTTP(w, req)
+}
+
+// fallback serves requests that matched a path but none of its methods: an
+// automatic OPTIONS response, a 405 listing the allowed methods, or a 404 for
+// paths with no routes at all.
+func (r *Router) fallback(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	registered := r.methods[req.Pattern]
+	r.mu.RUnlock()
+
+	if len(registered) == 0 {
+		renderError(r.OnError, w, req, NewHTTPError(http.StatusNotFound, ErrNotFound))
+		return
+	}
+
+	allowed := slices.Clone(registered)
+	if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if !slices.Contains(allowed, http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+	if req.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	renderError(r.OnError, w, req, NewHTTPError(http.StatusMethodNotAllowed, ErrMethodNotAllowed))
+}
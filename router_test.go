@@ -0,0 +1,82 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRouter covers method dispatch, group prefixes and middleware, and the
+// automatic 404, 405 and OPTIONS responses.
+func TestRouter(t *testing.T) {
+	tagged := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := NewRouter()
+	router.Use(tagged("root"))
+	router.GET("/users", Handler(UserHandler))
+
+	api := router.Group("/api/", tagged("api"))
+	api.POST("/users/{id}", Handler(UserHandler))
+	api.DELETE("/users/{id}", Handler(UserHandler))
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		wantCode   int
+		wantBody   string
+		wantAllow  string
+		wantMiddle []string
+	}{
+		{"get", http.MethodGet, "/users", http.StatusOK, `{"Name":"Goodbye"}` + "\n", "", []string{"root"}},
+		{"groupPost", http.MethodPost, "/api/users/7", http.StatusOK, `{"Name":"Goodbye"}` + "\n", "", []string{"root", "api"}},
+		{"methodNotAllowed", http.MethodPut, "/users", http.StatusMethodNotAllowed, `{"error":"method not allowed"}` + "\n", "GET, HEAD, OPTIONS", []string{"root"}},
+		{"options", http.MethodOptions, "/api/users/7", http.StatusNoContent, "", "POST, DELETE, OPTIONS", []string{"root", "api"}},
+		{"notFound", http.MethodGet, "/nope", http.StatusNotFound, `{"error":"not found"}` + "\n", "", []string{"root"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(c.method, c.path, strings.NewReader(`{}`)))
+
+			if recorder.Code != c.wantCode {
+				t.Errorf("expected status %d, got %d: %s", c.wantCode, recorder.Code, recorder.Body.String())
+			}
+			if c.wantBody != "" && recorder.Body.String() != c.wantBody {
+				t.Errorf("unexpected response: %s", recorder.Body.String())
+			}
+			if got := recorder.Header().Get("Allow"); got != c.wantAllow {
+				t.Errorf("expected Allow %q, got %q", c.wantAllow, got)
+			}
+			if got := recorder.Header().Values("X-Middleware"); !slices.Equal(got, c.wantMiddle) {
+				t.Errorf("expected middleware %v, got %v", c.wantMiddle, got)
+			}
+		})
+	}
+}
+
+// TestRouterOnError verifies 405s are rendered through a custom renderer.
+func TestRouterOnError(t *testing.T) {
+	router := NewRouter()
+	router.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), StatusCode(err))
+	}
+	router.GET("/users", Handler(UserHandler))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Body.String() != "method not allowed\n" {
+		t.Errorf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package mid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema document restricted to the draft 2020-12 keywords
+// mid enforces: type, enum, required, properties, additionalProperties, items,
+// pattern, minLength/maxLength, minimum/maximum,
+// exclusiveMinimum/exclusiveMaximum and minItems/maxItems. Other keywords are
+// ignored. Build one with CompileSchema so patterns are checked up front.
+type Schema struct {
+	Type                 SchemaType         `json:"type,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	boolean *bool          // set for the `true`/`false` schema shorthands
+	pattern *regexp.Regexp // compiled Pattern
+}
+
+// SchemaType is the "type" keyword, which may be a single name or a list.
+type SchemaType []string
+
+// UnmarshalJSON accepts both "string" and ["string", "null"].
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = SchemaType{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = many
+	return nil
+}
+
+// UnmarshalJSON accepts the boolean schemas `true` and `false` as well as
+// objects.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{boolean: &b}
+		return nil
+	}
+	type plain Schema // drop the method set to avoid recursing
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// CompileSchema parses a JSON Schema document and compiles its patterns.
+func CompileSchema(doc []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(doc, &s); err != nil {
+		return nil, fmt.Errorf("mid: parse schema: %w", err)
+	}
+	if err := s.compile("#"); err != nil {
+		return nil, fmt.Errorf("mid: compile schema: %w", err)
+	}
+	return &s, nil
+}
+
+// compile walks the schema tree compiling every pattern. at is the location
+// of s within the document, for error messages.
+func (s *Schema) compile(at string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s/pattern: %w", at, err)
+		}
+		s.pattern = re
+	}
+	for name, prop := range s.Properties {
+		loc := at + "/properties/" + escapePointer(name)
+		if prop == nil {
+			// a null items or additionalProperties reads as absent, but a null
+			// property would be looked up and validated, so refuse it here
+			return fmt.Errorf("%s: schema must be an object or a boolean", loc)
+		}
+		if err := prop.compile(loc); err != nil {
+			return err
+		}
+	}
+	if err := s.AdditionalProperties.compile(at + "/additionalProperties"); err != nil {
+		return err
+	}
+	return s.Items.compile(at + "/items")
+}
+
+// Validate checks doc — a value decoded with json.Decoder.UseNumber — against
+// the schema and returns every violation found. Each FieldError's Field is the
+// JSON Pointer of the offending value and its Tag is the failed keyword.
+func (s *Schema) Validate(doc any) []FieldError {
+	var errs []FieldError
+	s.validate(doc, "", &errs)
+	return errs
+}
+
+func (s *Schema) validate(v any, ptr string, errs *[]FieldError) {
+	fail := func(field, tag, format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: field, Tag: tag, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.boolean != nil {
+		if !*s.boolean {
+			fail(ptr, "false", "no value is allowed here")
+		}
+		return
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasJSONType(v, t) }) {
+		fail(ptr, "type", "expected %s, got %s", strings.Join(s.Type, " or "), jsonTypeOf(v))
+		return // the remaining keywords assume the right type
+	}
+
+	if len(s.Enum) > 0 {
+		norm := normalizeJSON(v)
+		if !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(norm, e) }) {
+			fail(ptr, "enum", "must be one of the allowed values")
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail(ptr, "minLength", "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail(ptr, "maxLength", "must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail(ptr, "pattern", "must match pattern %s", s.Pattern)
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail(ptr, "minimum", "must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail(ptr, "maximum", "must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			fail(ptr, "exclusiveMinimum", "must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+			fail(ptr, "exclusiveMaximum", "must be < %v", *s.ExclusiveMaximum)
+		}
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail(ptr, "minItems", "must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail(ptr, "maxItems", "must contain at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(item, fmt.Sprintf("%s/%d", ptr, i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				fail(ptr+"/"+escapePointer(name), "required", "is required")
+			}
+		}
+		// iterate in a stable order so responses are deterministic
+		for _, name := range slices.Sorted(maps.Keys(val)) {
+			child := ptr + "/" + escapePointer(name)
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(val[name], child, errs)
+			} else if s.AdditionalProperties != nil {
+				if ap := s.AdditionalProperties; ap.boolean != nil && !*ap.boolean {
+					fail(child, "additionalProperties", "is not allowed")
+				} else {
+					ap.validate(val[name], child, errs)
+				}
+			}
+		}
+	}
+}
+
+// hasJSONType reports whether v is an instance of the JSON Schema type name.
+func hasJSONType(v any, name string) bool {
+	switch name {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	default:
+		return jsonTypeOf(v) == name
+	}
+}
+
+// jsonTypeOf names the JSON type of a value decoded with UseNumber.
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// normalizeJSON converts json.Number values to float64 so a UseNumber-decoded
+// value compares equal to the same value decoded from the schema's enum.
+func normalizeJSON(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = normalizeJSON(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = normalizeJSON(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// pointerEscaper escapes the characters RFC 6901 reserves in reference tokens.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapePointer escapes a single JSON Pointer reference token (RFC 6901).
+func escapePointer(token string) string {
+	return pointerEscaper.Replace(token)
+}
+
+// SchemaDecoder wraps next so the raw request body is checked against schema
+// before it is decoded into T. Violations are returned as a ValidationErrors
+// whose fields are JSON Pointers; a nil next defaults to JSONDecoder:
+//
+//	mid.Handler(h, mid.WithDecoder(mid.SchemaDecoder[Input](schema, nil)))
+func SchemaDecoder[T any](schema *Schema, next Decoder[T]) Decoder[T] {
+	if next == nil {
+		next = JSONDecoder[T]
+	}
+	return func(r *http.Request, input *T) error {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return ErrJSONInvalid
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return ErrJSONInvalid
+		}
+
+		if errs := schema.Validate(doc); len(errs) > 0 {
+			return ValidationErrors{Errors: errs}
+		}
+
+		// hand the already-read body to the wrapped decoder
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return next(r, input)
+	}
+}
@@ -0,0 +1,107 @@
+package mid
+
+import (
+	"net/http"
+	"testing"
+)
+
+const signupSchema = `{
+	"type": "object",
+	"required": ["email", "plan"],
+	"additionalProperties": false,
+	"properties": {
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"plan": {"enum": ["free", "pro"]},
+		"seats": {"type": "integer", "minimum": 1, "maximum": 50},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 2}}
+	}
+}`
+
+type SchemaSignup struct {
+	Email string   `json:"email"`
+	Plan  string   `json:"plan"`
+	Seats int      `json:"seats"`
+	Tags  []string `json:"tags"`
+}
+
+// TestSchemaDecoder covers the raw body being checked against the schema
+// before decoding, with violations reported as JSON Pointer field errors.
+func TestSchemaDecoder(t *testing.T) {
+	schema, err := CompileSchema([]byte(signupSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "valid",
+			body:     `{"email":"a@b.co","plan":"pro","seats":3,"tags":["ab"]}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"email":"a@b.co","plan":"pro","seats":3,"tags":["ab"]}` + "\n",
+		},
+		{
+			name:     "violations",
+			body:     `{"email":"nope","seats":1.5,"tags":["a","bb","cc"],"x/y":1}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"errors":[` +
+				`{"field":"/plan","tag":"required","message":"is required"},` +
+				`{"field":"/email","tag":"pattern","message":"must match pattern ^[^@]+@[^@]+$"},` +
+				`{"field":"/seats","tag":"type","message":"expected integer, got number"},` +
+				`{"field":"/tags","tag":"maxItems","message":"must contain at most 2 items"},` +
+				`{"field":"/tags/0","tag":"minLength","message":"must be at least 2 characters"},` +
+				`{"field":"/x~1y","tag":"additionalProperties","message":"is not allowed"}` +
+				`]}` + "\n",
+		},
+		{
+			name:     "notJSON",
+			body:     `{nope`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"invalid JSON"}` + "\n",
+		},
+	}
+
+	handler := Handler(func(in SchemaSignup) (any, error) { return in, nil },
+		WithDecoder(SchemaDecoder[SchemaSignup](schema, nil)))
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := serve(handler, c.body)
+
+			if recorder.Code != c.wantCode {
+				t.Errorf("expected status %d, got %d: %s", c.wantCode, recorder.Code, recorder.Body.String())
+			}
+			if recorder.Body.String() != c.wantBody {
+				t.Errorf("unexpected response: %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestCompileSchemaBadPattern verifies invalid patterns are caught up front.
+func TestCompileSchemaBadPattern(t *testing.T) {
+	_, err := CompileSchema([]byte(`{"properties":{"a":{"pattern":"("}}}`))
+	if err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+// TestCompileSchemaNull verifies a null property schema is refused rather than
+// panicking at validation, while a null items schema reads as absent.
+func TestCompileSchemaNull(t *testing.T) {
+	if _, err := CompileSchema([]byte(`{"properties":{"a":null}}`)); err == nil {
+		t.Fatal("expected an error for a null property schema")
+	}
+
+	schema, err := CompileSchema([]byte(`{"items":null,"additionalProperties":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := schema.Validate([]any{"x", 1}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
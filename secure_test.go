@@ -0,0 +1,94 @@
+package mid
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSecureHeaders checks the default headers, HSTS only over TLS, no-store
+// only on errors, and per-route overrides.
+func TestSecureHeaders(t *testing.T) {
+	router := NewRouter()
+	router.Use(SecureHeaders(SecureHeadersOptions{HSTSIncludeSubdomains: true}))
+	router.POST("/users", Handler(UserHandler))
+	router.POST("/fail", Handler(func(u User) (any, error) {
+		return nil, NewHTTPError(http.StatusInternalServerError, errors.New("boom"))
+	}))
+	docs := router.Group("/docs", SecureHeaders(SecureHeadersOptions{ContentSecurityPolicy: "default-src 'self'", FrameOptions: "-"}))
+	docs.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(method, path string, secure bool) http.Header {
+		request := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		if secure {
+			request.TLS = &tls.ConnectionState{}
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Header()
+	}
+
+	h := do(http.MethodPost, "/users", false)
+	for k, v := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+		"Referrer-Policy":         "no-referrer",
+		"X-Frame-Options":         "DENY",
+		"Content-Type":            "application/json; charset=utf-8",
+	} {
+		if h.Get(k) != v {
+			t.Errorf("expected %s: %q, got %q", k, v, h.Get(k))
+		}
+	}
+	if h.Get("Strict-Transport-Security") != "" || h.Get("Cache-Control") != "" {
+		t.Errorf("expected no HSTS over plain HTTP and no no-store on success, got %v", h)
+	}
+
+	if h := do(http.MethodPost, "/users", true); h.Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" {
+		t.Errorf("expected HSTS over TLS, got %q", h.Get("Strict-Transport-Security"))
+	}
+	if h := do(http.MethodPost, "/fail", false); h.Get("Cache-Control") != "no-store" {
+		t.Errorf("expected no-store on an error response, got %q", h.Get("Cache-Control"))
+	}
+
+	h = do(http.MethodGet, "/docs/", false)
+	if h.Get("Content-Security-Policy") != "default-src 'self'" || h.Get("X-Frame-Options") != "" {
+		t.Errorf("expected the group to override the policy, got %v", h)
+	}
+}
+
+// TestSecureHeadersHSTS checks the forwarded scheme comes from the first
+// X-Forwarded-Proto entry, and that short max-ages round up to a second.
+func TestSecureHeadersHSTS(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		forwarded string
+		want      string
+	}{
+		{"forwarded", 0, "https", "max-age=31536000"},
+		{"forwardedList", 0, "https, http", "max-age=31536000"},
+		{"forwardedLastHTTPS", 0, "http, https", ""},
+		{"plain", 0, "", ""},
+		{"subSecond", 500 * time.Millisecond, "https", "max-age=1"},
+		{"disabled", -1, "https", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecureHeaders(SecureHeadersOptions{HSTSMaxAge: tt.maxAge, TrustForwardedProto: true})(http.NotFoundHandler())
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-Proto", tt.forwarded)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if got := recorder.Header().Get("Strict-Transport-Security"); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrNotReady is rendered, wrapped in a 503 HTTPError, by a Readiness that is
+// not ready, e.g. while the server drains.
+var ErrNotReady = errors.New("not ready")
+
+// ErrForcedShutdown is returned by Serve when a signal cut the graceful
+// shutdown short.
+var ErrForcedShutdown = errors.New("forced shutdown")
+
+// Readiness is a flag load balancers can poll through its ServeHTTP method.
+// The zero value is not ready; Serve marks it ready once listening and not
+// ready again before it starts draining, so traffic moves elsewhere first.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+// SetReady sets the flag.
+func (rd *Readiness) SetReady(ready bool) {
+	rd.ready.Store(ready)
+}
+
+// Ready reports the flag.
+func (rd *Readiness) Ready() bool {
+	return rd.ready.Load()
+}
+
+// ServeHTTP responds 200 `{"status":"ready"}` when ready and otherwise
+// renders a 503 wrapping ErrNotReady through the Defaults' ErrorRenderer.
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !rd.Ready() {
+		renderError(nil, w, r, NewHTTPError(http.StatusServiceUnavailable, ErrNotReady))
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Write([]byte(`{"status":"ready"}` + "\n"))
+}
+
+// serveConfig collects what ServeOptions set.
+type serveConfig struct {
+	listener   net.Listener
+	grace      time.Duration
+	drainDelay time.Duration
+	readiness  *Readiness
+	hooks      []func(ctx context.Context) error
+	signals    chan os.Signal // nil means os.Interrupt and SIGTERM
+}
+
+// ServeOption customizes Serve. See WithListener, WithGracePeriod,
+// WithDrainDelay, WithReadiness and OnShutdown.
+type ServeOption func(*serveConfig)
+
+// WithListener makes Serve accept connections on l instead of listening on
+// srv.Addr. With srv.TLSConfig set, l should be a plain listener; Serve adds
+// the TLS layer.
+func WithListener(l net.Listener) ServeOption {
+	return func(c *serveConfig) { c.listener = l }
+}
+
+// WithGracePeriod sets how long in-flight requests get to finish once
+// shutdown begins, and separately how long the shutdown hooks get. It
+// defaults to 30 seconds.
+func WithGracePeriod(d time.Duration) ServeOption {
+	return func(c *serveConfig) { c.grace = d }
+}
+
+// WithDrainDelay makes Serve wait d between failing readiness and closing
+// its listeners, giving load balancers time to notice. It defaults to zero.
+func WithDrainDelay(d time.Duration) ServeOption {
+	return func(c *serveConfig) { c.drainDelay = d }
+}
+
+// WithReadiness makes Serve maintain rd: ready while serving, not ready once
+// shutdown begins.
+func WithReadiness(rd *Readiness) ServeOption {
+	return func(c *serveConfig) { c.readiness = rd }
+}
+
+// OnShutdown registers a hook run after the server has drained, e.g. to close
+// a database pool. Hooks run in the order registered, each with a context
+// bounded by the grace period, or already canceled after a forced shutdown;
+// their errors are joined into Serve's result.
+func OnShutdown(hook func(ctx context.Context) error) ServeOption {
+	return func(c *serveConfig) { c.hooks = append(c.hooks, hook) }
+}
+
+// Serve runs srv until ctx is done or the process receives an interrupt or
+// SIGTERM, then shuts down gracefully: readiness is failed, the drain delay
+// passes, in-flight requests get the grace period to finish, and the shutdown
+// hooks run. A signal during all this (a second one, when a signal started
+// it) closes every connection at once and makes Serve return
+// ErrForcedShutdown (after the hooks have run, with a canceled context);
+// signals are no longer caught from then on, so another one kills the
+// process. When srv.TLSConfig is set, Serve serves TLS using the certificates
+// it holds.
+//
+// Serve pairs with InterruptContext, which cancels on the first signal; that
+// signal starts the shutdown rather than forcing it:
+//
+//	err := mid.Serve(mid.InterruptContext(), srv, mid.WithReadiness(ready))
+func Serve(ctx context.Context, srv *http.Server, opts ...ServeOption) error {
+	c := serveConfig{grace: 30 * time.Second, readiness: &Readiness{}}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.signals == nil {
+		c.signals = make(chan os.Signal, 2)
+		signal.Notify(c.signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(c.signals)
+	}
+	// the first signal starts the shutdown and the next forces it; once ctx
+	// has started it, draining skips straight to waiting for the force
+	stop, force, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	draining := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-c.signals:
+			close(stop)
+		case <-draining:
+		case <-finished:
+			return
+		}
+		select {
+		case <-c.signals:
+			close(force)
+		case <-finished:
+			return
+		}
+		signal.Stop(c.signals)
+	}()
+
+	// listen before reporting ready, so readiness never runs ahead of the
+	// socket
+	ln := c.listener
+	if ln == nil {
+		addr := srv.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+	}
+	served := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			served <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		served <- srv.Serve(ln)
+	}()
+	c.readiness.SetReady(true)
+
+	select {
+	case err := <-served:
+		c.readiness.SetReady(false)
+		return err
+	case <-ctx.Done():
+		// InterruptContext's signal reached us too and will count as the
+		// first; any other cause leaves the first signal to force
+		if _, ok := errors.AsType[interrupted](context.Cause(ctx)); !ok {
+			close(draining)
+		}
+	case <-stop:
+	}
+
+	c.readiness.SetReady(false)
+	var errs []error
+
+	forced := false
+	select {
+	case <-time.After(c.drainDelay):
+	case <-force:
+		forced = true
+	}
+
+	if !forced {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), c.grace)
+		shutdown := make(chan error, 1)
+		go func() { shutdown <- srv.Shutdown(shutdownCtx) }()
+		select {
+		case err := <-shutdown:
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = errors.Join(err, srv.Close()) // grace period over; cut the stragglers off
+			}
+			errs = append(errs, err)
+		case <-force:
+			forced = true
+		}
+		cancel()
+	}
+	if forced {
+		errs = append(errs, ErrForcedShutdown, srv.Close())
+	}
+
+	for _, hook := range c.hooks {
+		hookCtx, cancel := context.WithTimeout(context.Background(), c.grace)
+		if forced {
+			cancel() // the operator asked to stop now
+		}
+		errs = append(errs, hook(hookCtx))
+		cancel()
+	}
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
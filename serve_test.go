@@ -0,0 +1,236 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// withSignals makes Serve read signals from ch instead of the process.
+func withSignals(ch chan os.Signal) ServeOption {
+	return func(c *serveConfig) { c.signals = ch }
+}
+
+// startServe runs Serve on a local listener with handler, returning the base
+// URL and a channel receiving Serve's result.
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, opts ...ServeOption) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- Serve(ctx, &http.Server{Handler: handler}, append(opts, WithListener(ln))...)
+	}()
+	return "http://" + ln.Addr().String(), result
+}
+
+// TestServeGracefulShutdown checks that cancelling the context fails
+// readiness, lets the in-flight request finish, and then runs the hooks in
+// order.
+func TestServeGracefulShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+
+	ready := &Readiness{}
+	var hooks []string
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startServe(t, ctx, handler,
+		WithReadiness(ready),
+		withSignals(make(chan os.Signal)),
+		OnShutdown(func(ctx context.Context) error { hooks = append(hooks, "first"); return nil }),
+		OnShutdown(func(ctx context.Context) error { hooks = append(hooks, "second"); return nil }),
+	)
+
+	response := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Error(err)
+		}
+		response <- resp
+	}()
+	<-started
+	if !ready.Ready() {
+		t.Error("expected readiness while serving")
+	}
+
+	cancel()
+	waitFor(t, func() bool { return !ready.Ready() })
+	recorder := httptest.NewRecorder()
+	ready.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail with %d while draining, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	close(release)
+	if resp := <-response; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the in-flight request to complete, got %v", resp)
+	} else {
+		resp.Body.Close()
+	}
+	if err := <-result; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	if !slices.Equal(hooks, []string{"first", "second"}) {
+		t.Errorf("expected hooks to run in order, got %v", hooks)
+	}
+}
+
+// TestServeForcedShutdown checks that a second signal abandons the drain,
+// still running the hooks.
+func TestServeForcedShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	signals := make(chan os.Signal, 2)
+	var hookErr error
+	hookRan := false
+	url, result := startServe(t, context.Background(), handler,
+		withSignals(signals),
+		OnShutdown(func(ctx context.Context) error { hookRan, hookErr = true, ctx.Err(); return nil }),
+	)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	signals <- os.Interrupt
+	signals <- os.Interrupt
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrForcedShutdown) {
+			t.Errorf("expected ErrForcedShutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the second signal to force the shutdown")
+	}
+	if !hookRan || hookErr == nil {
+		t.Errorf("expected the hooks to run with a canceled context after a forced shutdown, got %v", hookErr)
+	}
+}
+
+// TestServeForcedAfterCancel checks that once the context has started the
+// shutdown, the first signal forces it, unless InterruptContext's own signal
+// canceled the context, in which case that signal counts as the first.
+func TestServeForcedAfterCancel(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cause   error
+		signals int
+	}{
+		{"canceled", nil, 1},
+		{"interrupted", interrupted{os.Interrupt}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+			})
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			signals := make(chan os.Signal, 2)
+			ready := &Readiness{}
+			url, result := startServe(t, ctx, handler, withSignals(signals), WithReadiness(ready))
+
+			go func() {
+				if resp, err := http.Get(url); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+			cancel(tc.cause)
+			for ready.Ready() {
+				time.Sleep(time.Millisecond) // wait for the drain to begin
+			}
+
+			for i := 1; i <= tc.signals; i++ {
+				signals <- os.Interrupt
+				select {
+				case err := <-result:
+					if i < tc.signals {
+						t.Fatalf("signal %d forced the shutdown: %v", i, err)
+					}
+					if !errors.Is(err, ErrForcedShutdown) {
+						t.Errorf("expected ErrForcedShutdown, got %v", err)
+					}
+				case <-time.After(100 * time.Millisecond):
+					if i == tc.signals {
+						t.Fatalf("expected signal %d to force the shutdown", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestServeTLS checks that a server with a TLSConfig is served over TLS
+// rather than plaintext.
+func TestServeTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(nil)
+	config, client := ts.TLS.Clone(), ts.Client()
+	ts.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("secure")) }),
+		TLSConfig: config,
+	}
+	result := make(chan error, 1)
+	go func() { result <- Serve(ctx, srv, WithListener(ln), withSignals(make(chan os.Signal))) }()
+
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil {
+		t.Error("expected a TLS connection")
+	}
+
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestServeListenError checks that Serve reports a failure to listen without
+// ever marking itself ready.
+func TestServeListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	ready := &Readiness{}
+	srv := &http.Server{Addr: taken.Addr().String()}
+	err = Serve(context.Background(), srv, WithReadiness(ready), withSignals(make(chan os.Signal)))
+	if err == nil || ready.Ready() {
+		t.Errorf("expected a listen error without readiness, got %v", err)
+	}
+}
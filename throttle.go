@@ -0,0 +1,211 @@
+package mid
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is rendered, wrapped in a 503 HTTPError, when a Throttler
+// can't admit a request in time.
+var ErrOverloaded = errors.New("server is too busy")
+
+// Priority classifies a request for a Throttler.
+type Priority int
+
+const (
+	// PriorityNormal requests wait in the queue in arrival order.
+	PriorityNormal Priority = iota
+	// PriorityHigh requests are admitted before any waiting normal request.
+	PriorityHigh
+	// PriorityBypass requests skip the throttler entirely and aren't counted,
+	// e.g. health checks and admin routes.
+	PriorityBypass
+)
+
+// ThrottlerOptions configures a Throttler.
+type ThrottlerOptions struct {
+	Concurrency int           // requests served at once
+	Timeout     time.Duration // longest a request waits for a slot
+	MaxWaiting  int           // queue length beyond which requests are rejected at once; 0 means unbounded
+
+	// RetryAfter is sent, in whole seconds, with rejections; it defaults to
+	// Timeout, and to at least one second.
+	RetryAfter time.Duration
+
+	Priority func(r *http.Request) Priority // defaults to PriorityNormal for everything
+	OnError  ErrorRenderer                  // renders the 503; defaults to the Defaults' ErrorRenderer
+
+	// Metrics, when set, gets the throttler's in-flight and waiting gauges
+	// (see Throttler.Instrument), labelled with Name. Name defaults to
+	// "default"; give each instrumented throttler its own.
+	Metrics *Metrics
+	Name    string
+}
+
+// Throttler limits how many requests are served at once, queueing the rest
+// for up to a timeout. It exposes its in-flight and waiting counts for
+// monitoring and can let priority requests jump or bypass the queue.
+type Throttler struct {
+	opts ThrottlerOptions
+
+	mu       sync.Mutex
+	inFlight int
+	queues   [2]*list.List // waiters by priority: PriorityNormal, PriorityHigh
+	timers   sync.Pool     // *time.Timer, reused across waits
+}
+
+// throttleWaiter is one queued request. ready is closed when a slot has been
+// handed to it; granted records that under the lock.
+type throttleWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewThrottler returns a Throttler configured by opts.
+func NewThrottler(opts ThrottlerOptions) *Throttler {
+	if opts.Concurrency < 1 {
+		panic("mid: Throttler requires a positive Concurrency")
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = max(opts.Timeout.Round(time.Second), time.Second)
+	}
+	t := &Throttler{opts: opts, queues: [2]*list.List{list.New(), list.New()}}
+	if opts.Metrics != nil {
+		if opts.Name == "" {
+			opts.Name = "default"
+		}
+		t.Instrument(opts.Metrics, opts.Name)
+	}
+	return t
+}
+
+// InFlight returns the number of requests currently being served.
+func (t *Throttler) InFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlight
+}
+
+// Waiting returns the number of requests queued for a slot.
+func (t *Throttler) Waiting() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waiting()
+}
+
+// waiting is Waiting for callers holding t.mu.
+func (t *Throttler) waiting() int {
+	return t.queues[PriorityNormal].Len() + t.queues[PriorityHigh].Len()
+}
+
+// Handler wraps next. It follows the func(http.Handler) http.Handler
+// convention, so t.Handler can be passed to Chain or Router.Use.
+func (t *Throttler) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prio := PriorityNormal
+		if t.opts.Priority != nil {
+			prio = t.opts.Priority(r)
+		}
+		if prio == PriorityBypass {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if prio != PriorityHigh {
+			prio = PriorityNormal
+		}
+
+		switch t.acquire(r, prio) {
+		case acquired:
+			defer t.release() // release even if next panics
+			next.ServeHTTP(w, r)
+		case rejected:
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(t.opts.RetryAfter.Seconds())))
+			renderError(t.opts.OnError, w, r, NewHTTPError(http.StatusServiceUnavailable, ErrOverloaded))
+		case canceled:
+			// the client went away; there is no one to respond to
+		}
+	})
+}
+
+// acquireResult is the outcome of waiting for a slot.
+type acquireResult int
+
+const (
+	acquired acquireResult = iota
+	rejected
+	canceled
+)
+
+// acquire takes a slot, queueing at prio for up to the timeout if none is free.
+func (t *Throttler) acquire(r *http.Request, prio Priority) acquireResult {
+	t.mu.Lock()
+	if t.inFlight < t.opts.Concurrency && t.waiting() == 0 {
+		t.inFlight++
+		t.mu.Unlock()
+		return acquired
+	}
+	if t.opts.MaxWaiting > 0 && t.waiting() >= t.opts.MaxWaiting {
+		t.mu.Unlock()
+		return rejected
+	}
+	waiter := &throttleWaiter{ready: make(chan struct{})}
+	elem := t.queues[prio].PushBack(waiter)
+	t.mu.Unlock()
+
+	timer := t.timer(t.opts.Timeout)
+	defer t.timers.Put(timer)
+	defer timer.Stop()
+
+	var result acquireResult
+	select {
+	case <-waiter.ready:
+		return acquired
+	case <-timer.C:
+		result = rejected
+	case <-r.Context().Done():
+		result = canceled
+	}
+
+	t.mu.Lock()
+	granted := waiter.granted
+	if !granted {
+		t.queues[prio].Remove(elem)
+	}
+	t.mu.Unlock()
+
+	if granted {
+		// a slot arrived while we were giving up; pass it on
+		t.release()
+	}
+	return result
+}
+
+// release frees a slot, handing it straight to the next waiter (high priority
+// first) if there is one.
+func (t *Throttler) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, q := range []*list.List{t.queues[PriorityHigh], t.queues[PriorityNormal]} {
+		if e := q.Front(); e != nil {
+			waiter := q.Remove(e).(*throttleWaiter)
+			waiter.granted = true
+			close(waiter.ready)
+			return // the slot moves to the waiter; inFlight is unchanged
+		}
+	}
+	t.inFlight--
+}
+
+// timer returns a pooled timer set to fire after d.
+func (t *Throttler) timer(d time.Duration) *time.Timer {
+	if timer, ok := t.timers.Get().(*time.Timer); ok {
+		timer.Reset(d)
+		return timer
+	}
+	return time.NewTimer(d)
+}
@@ -0,0 +1,115 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestThrottler covers the in-flight/waiting counts, high priority requests
+// being admitted before normal ones, bypass, and the JSON 503 rejection with
+// Retry-After.
+func TestThrottler(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+
+	throttler := NewThrottler(ThrottlerOptions{
+		Concurrency: 1,
+		Timeout:     time.Second,
+		MaxWaiting:  2,
+		Priority: func(r *http.Request) Priority {
+			switch r.URL.Path {
+			case "/admin":
+				return PriorityHigh
+			case "/healthz":
+				return PriorityBypass
+			}
+			return PriorityNormal
+		},
+	})
+	handler := throttler.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { get("/slow") })
+	waitFor(t, func() bool { return throttler.InFlight() == 1 })
+
+	wg.Go(func() { get("/normal") })
+	waitFor(t, func() bool { return throttler.Waiting() == 1 })
+	wg.Go(func() { get("/admin") })
+	waitFor(t, func() bool { return throttler.Waiting() == 2 })
+
+	// health checks skip the full queue
+	if code := get("/healthz").Code; code != http.StatusOK {
+		t.Errorf("expected bypass to succeed, got %d", code)
+	}
+
+	// the queue is full, so this is rejected at once
+	recorder := get("/rejected")
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if recorder.Header().Get("Retry-After") != "1" || recorder.Body.String() != `{"error":"server is too busy"}`+"\n" {
+		t.Errorf("unexpected rejection %v: %s", recorder.Header(), recorder.Body.String())
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := strings.Join(order, ","); got != "/slow,/healthz,/admin,/normal" {
+		t.Errorf("unexpected admission order %s", got)
+	}
+	if throttler.InFlight() != 0 || throttler.Waiting() != 0 {
+		t.Errorf("expected an idle throttler, got %d in flight and %d waiting", throttler.InFlight(), throttler.Waiting())
+	}
+}
+
+// TestRequestThrottlerTimeout verifies a request that waits past the timeout
+// is rejected.
+func TestRequestThrottlerTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := RequestThrottler(1, 10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	wg.Go(func() { handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)) })
+	defer wg.Wait()
+	defer close(release)
+	<-started
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
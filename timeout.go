@@ -0,0 +1,194 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is rendered, wrapped in an HTTPError, when a request doesn't
+// finish within its time limit: a 503 from the Timeout middleware, a 504 from
+// a Handler built with WithTimeout.
+var ErrTimeout = errors.New("request timed out")
+
+// Timeout bounds how long next may take. The request's context gets a
+// deadline d away; if next hasn't returned by then, a 503 wrapping ErrTimeout
+// is rendered through onErr, or the Defaults' ErrorRenderer when onErr is nil.
+//
+// Unlike http.TimeoutHandler the error is rendered like any other, as JSON by
+// default. next writes to a buffer that is copied out only if it finishes in
+// time, so a late handler can't corrupt the error response; its writes fail
+// with http.ErrHandlerTimeout. Because of the buffering, next can't stream or
+// hijack the connection. A panic in next is re-raised with next's stack.
+func Timeout(d time.Duration, onErr ErrorRenderer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- withStack(p)
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				// a handler finishing just as the deadline passes still gets
+				// its response out
+				select {
+				case p := <-panicked:
+					panic(p)
+				case <-done:
+				default:
+					tw.mu.Lock()
+					tw.timedOut = true
+					tw.mu.Unlock()
+					if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+						renderError(onErr, w, r, NewHTTPError(http.StatusServiceUnavailable, ErrTimeout))
+					}
+					// otherwise the client went away; there is no one to respond to
+					return
+				}
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			dst := w.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+		})
+	}
+}
+
+// goroutinePanic is a panic recovered in another goroutine, re-raised with the
+// stack it was recovered on since the re-raising goroutine's stack says
+// nothing about where it happened.
+type goroutinePanic struct {
+	value any
+	stack []byte
+}
+
+func (p *goroutinePanic) Error() string {
+	return fmt.Sprintf("%v\n\ngoroutine stack:\n%s", p.value, p.stack)
+}
+
+// Unwrap returns the original panic value when it was an error.
+func (p *goroutinePanic) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+// withStack wraps a recovered panic value with the current stack. It must be
+// called from the deferred function that recovered it. http.ErrAbortHandler
+// is left alone so net/http still aborts quietly.
+func withStack(p any) any {
+	if p == http.ErrAbortHandler {
+		return p
+	}
+	return &goroutinePanic{value: p, stack: debug.Stack()}
+}
+
+// timeoutWriter buffers a response for Timeout. Once timedOut is set the
+// buffer is abandoned and further writes fail.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// Header returns the buffered header map. Like any header map it must not be
+// changed after WriteHeader.
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write buffers b, or fails with http.ErrHandlerTimeout after the deadline.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// WriteHeader records status; only the first call counts.
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// callWithTimeout runs call in its own goroutine and gives up on it when ctx
+// is done: with a 504 wrapping ErrTimeout when its deadline passed, or ctx's
+// error when it was canceled. A panic in call is re-raised in the caller,
+// carrying call's stack.
+func callWithTimeout[T any](ctx context.Context, call func(*http.Request, T) (any, error), r *http.Request, input T) (any, error) {
+	type result struct {
+		response any
+		err      error
+		panicked any
+	}
+	done := make(chan result, 1) // buffered, so a late call doesn't leak
+	go func() {
+		var res result
+		defer func() {
+			if p := recover(); p != nil {
+				res.panicked = withStack(p)
+			}
+			done <- res
+		}()
+		res.response, res.err = call(r, input)
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		// prefer a result that arrived with the deadline
+		select {
+		case res = <-done:
+		default:
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, NewHTTPError(http.StatusGatewayTimeout, ErrTimeout)
+			}
+			// the client went away, which isn't a timeout
+			return nil, ctx.Err()
+		}
+	}
+	if res.panicked != nil {
+		panic(res.panicked)
+	}
+	return res.response, res.err
+}
@@ -0,0 +1,148 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTimeout checks that a handler finishing in time is passed through
+// untouched, and that a slow one gets a JSON 503 its late writes can't
+// corrupt.
+func TestTimeout(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond) // let the 503 be written first
+		w.Header().Set("X-Late", "yes")
+		_, err := w.Write([]byte("late"))
+		lateWrite <- err
+	})
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("expected the request context to have a deadline")
+		}
+		w.Header().Set("X-Fast", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+
+	timeout := Timeout(20*time.Millisecond, nil)
+
+	recorder := httptest.NewRecorder()
+	timeout(fast).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != "done" || recorder.Header().Get("X-Fast") != "yes" {
+		t.Errorf("expected the fast response to pass through, got %d %q %v", recorder.Code, recorder.Body.String(), recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	timeout(slow).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), ErrTimeout.Error()) {
+		t.Errorf("expected a JSON timeout error, got %q", recorder.Body.String())
+	}
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("expected the late write to fail with ErrHandlerTimeout, got %v", err)
+	}
+	if recorder.Header().Get("X-Late") != "" || strings.Contains(recorder.Body.String(), "late") {
+		t.Errorf("expected the late handler's output to be dropped, got %v %q", recorder.Header(), recorder.Body.String())
+	}
+}
+
+// TestHandlerWithTimeout checks that a slow HandlerFunc is abandoned with a 504
+// routed through the ErrorHandler.
+func TestHandlerWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var handled error
+	h := Handler(func(u User) (any, error) {
+		<-release
+		return u, nil
+	},
+		WithTimeout[User](20*time.Millisecond),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, input User, err error) {
+			handled = err
+			JSONErrorHandler(w, r, input, err)
+		}),
+	)
+
+	recorder := serve(h, `{"Name":"John"}`)
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, recorder.Code)
+	}
+	if !errors.Is(handled, ErrTimeout) {
+		t.Errorf("expected the ErrorHandler to receive ErrTimeout, got %v", handled)
+	}
+
+	// handlers that finish in time are unaffected
+	h = Handler(UserHandler, WithTimeout[User](time.Second))
+	if recorder := serve(h, `{"Name":"John"}`); recorder.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+// TestCallWithTimeoutCanceled verifies a client going away isn't reported as
+// a timeout.
+func TestCallWithTimeoutCanceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	_, err := callWithTimeout(ctx, func(r *http.Request, u User) (any, error) {
+		<-release
+		return u, nil
+	}, request, User{})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestTimeoutPanicStack verifies panics cross the goroutine boundary with the
+// stack they were raised on, and that http.ErrAbortHandler passes unchanged.
+func TestTimeoutPanicStack(t *testing.T) {
+	errBoom := errors.New("boom")
+	recovered := func(f func()) (p any) {
+		defer func() { p = recover() }()
+		f()
+		return nil
+	}
+	check := func(name string, p any) {
+		err, ok := p.(error)
+		if !ok || !errors.Is(err, errBoom) {
+			t.Fatalf("%s: expected a panic wrapping errBoom, got %v", name, p)
+		}
+		if !strings.Contains(err.Error(), "TestTimeoutPanicStack.func") {
+			t.Errorf("%s: expected the panic to carry the handler's stack, got %s", name, err)
+		}
+	}
+
+	h := Timeout(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errBoom)
+	}))
+	check("Timeout", recovered(func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	check("callWithTimeout", recovered(func() {
+		callWithTimeout(t.Context(), func(r *http.Request, u User) (any, error) { panic(errBoom) }, request, User{})
+	}))
+
+	h = Timeout(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	if p := recovered(func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}); p != http.ErrAbortHandler {
+		t.Errorf("expected http.ErrAbortHandler to pass unchanged, got %v", p)
+	}
+}
@@ -0,0 +1,210 @@
+package mid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer starts spans. It is deliberately small so an OpenTelemetry tracer
+// (or any other) can be adapted in a few lines: Start creates a span as a
+// child of the span in ctx, or of the remote parent SpanContextFrom(ctx)
+// reports, and returns a context carrying the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key/value pair describing a span, e.g. http.route.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanContext identifies a span across process boundaries, as carried by the
+// W3C traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte   // bit 0 is "sampled"
+	TraceState string // vendor data, passed through untouched
+	Remote     bool   // received from another process
+}
+
+// IsValid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Versions above 00 are
+// accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(parts[0])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+	return sc, sc.IsValid() && strings.ToLower(s) == s
+}
+
+// spanContextKey is the context key for the current SpanContext.
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc as the current
+// span, which Tracers use as the parent of the next span they start.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFrom returns the current SpanContext in ctx, if any.
+func SpanContextFrom(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// ExtractTraceContext returns r's context carrying the remote parent from its
+// traceparent and tracestate headers, unless the context already has a span
+// or the headers are missing or malformed.
+func ExtractTraceContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if _, ok := SpanContextFrom(ctx); ok {
+		return ctx
+	}
+	sc, ok := ParseTraceparent(r.Header.Get("traceparent"))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = r.Header.Get("tracestate")
+	sc.Remote = true
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers of an
+// outgoing request from the current span in ctx, if any.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	sc, ok := SpanContextFrom(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+	h.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set("tracestate", sc.TraceState)
+	}
+}
+
+// MemoryTracer is a Tracer that keeps every span in memory, for tests. Its
+// spans follow W3C trace context: children share the parent's trace ID and
+// trace state.
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []*MemorySpan
+}
+
+// MemorySpan is a span recorded by a MemoryTracer.
+type MemorySpan struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext // zero for a root span
+	Attributes map[string]any
+	Errors     []error
+	StartTime  time.Time
+	EndTime    time.Time // zero until End is called
+
+	tracer *MemoryTracer
+}
+
+// Start implements Tracer.
+func (t *MemoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := SpanContextFrom(ctx)
+	sc := SpanContext{Flags: 1}
+	if parent.IsValid() {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &MemorySpan{Name: name, Context: sc, Parent: parent, Attributes: map[string]any{}, StartTime: time.Now(), tracer: t}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Spans returns copies of the spans started so far, in start order.
+func (t *MemoryTracer) Spans() []MemorySpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]MemorySpan, len(t.spans))
+	for i, s := range t.spans {
+		spans[i] = *s
+		spans[i].Attributes = maps.Clone(s.Attributes)
+		spans[i].Errors = slices.Clone(s.Errors)
+	}
+	return spans
+}
+
+// Reset forgets every span.
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+// SetAttributes implements Span.
+func (s *MemorySpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+// RecordError implements Span.
+func (s *MemorySpan) RecordError(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.Errors = append(s.Errors, err)
+}
+
+// End implements Span.
+func (s *MemorySpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.EndTime = time.Now()
+}
@@ -0,0 +1,103 @@
+package mid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header string
+		valid  bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceparent(tt.header)
+		if ok != tt.valid {
+			t.Errorf("%q: expected valid=%v, got %v", tt.header, tt.valid, ok)
+		}
+		if ok && tt.valid && strings.HasPrefix(tt.header, "00-") && sc.Traceparent() != tt.header {
+			t.Errorf("expected %q to round trip, got %q", tt.header, sc.Traceparent())
+		}
+	}
+}
+
+// TestHandlerTracing checks that a Handler continues the incoming trace, wraps
+// each phase in a child span, and records the failing phase's error.
+func TestHandlerTracing(t *testing.T) {
+	tracer := &MemoryTracer{}
+	router := NewRouter()
+	router.POST("/users", Handler(UserHandler, WithTracer[User](tracer), WithValidator(func(u User) error {
+		if u.Name == "" {
+			return errors.New("name required")
+		}
+		return nil
+	})))
+
+	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"Name":"John"}`))
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	request.Header.Set("tracestate", "vendor=1")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := tracer.Spans()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	want := []string{"mid.Handler", "mid.query", "mid.decode", "mid.transform", "mid.validate", "mid.handler", "mid.encode"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("expected spans %v, got %v", want, names)
+	}
+
+	root := spans[0]
+	if !root.Parent.Remote || root.Parent.Traceparent() != request.Header.Get("traceparent") {
+		t.Errorf("expected the root span to continue the remote parent, got %+v", root.Parent)
+	}
+	if root.Context.TraceState != "vendor=1" {
+		t.Errorf("expected the trace state to propagate, got %q", root.Context.TraceState)
+	}
+	for k, v := range map[string]any{
+		"http.route":                "POST /users",
+		"http.request.method":       "POST",
+		"mid.input_type":            "mid.User",
+		"http.response.status_code": http.StatusOK,
+	} {
+		if root.Attributes[k] != v {
+			t.Errorf("expected root attribute %s=%v, got %v", k, v, root.Attributes[k])
+		}
+	}
+	for _, s := range spans[1:] {
+		if s.Parent.SpanID != root.Context.SpanID || s.Context.TraceID != root.Context.TraceID {
+			t.Errorf("expected %s to be a child of the root span", s.Name)
+		}
+		if s.EndTime.IsZero() {
+			t.Errorf("expected %s to have ended", s.Name)
+		}
+	}
+
+	tracer.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`)))
+	spans = tracer.Spans()
+	last := spans[len(spans)-1]
+	if last.Name != "mid.validate" || len(last.Errors) != 1 {
+		t.Errorf("expected the pipeline to stop at a failed mid.validate span, got %s with %v", last.Name, last.Errors)
+	}
+	if spans[0].Parent.IsValid() {
+		t.Error("expected a new trace without a traceparent header")
+	}
+	if spans[0].Attributes["http.response.status_code"] != http.StatusBadRequest {
+		t.Errorf("expected status %d on the root span, got %v", http.StatusBadRequest, spans[0].Attributes["http.response.status_code"])
+	}
+}
@@ -0,0 +1,290 @@
+package mid
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// FieldMod is the struct tag key listing the modifiers applied to a field
+// between decoding and validation, e.g. `mod:"trim,lower"`. Modifiers run left
+// to right.
+const FieldMod = "mod"
+
+// ErrUnknownModifier is returned when a `mod` tag names a modifier that was
+// never registered, and ErrModifierField when a `mod` tag is on a field that
+// holds no strings. Both are programmer errors, caught when the Handler is
+// built.
+var (
+	ErrUnknownModifier = errors.New("unknown modifier")
+	ErrModifierField   = errors.New("mod tag on a field without strings")
+)
+
+// ModifierFunc rewrites a single string value, e.g. strings.TrimSpace.
+type ModifierFunc func(s string) string
+
+// Transformer normalizes a decoded input in place before it is validated.
+// Returning a non-nil error routes it to the configured ErrorHandler; the
+// Transformer must not write to w itself.
+type Transformer[T any] func(input *T) error
+
+// Modifiers is a registry of named ModifierFuncs referenced by `mod` tags. It
+// is safe for concurrent use, so custom modifiers may be registered at any
+// time.
+type Modifiers struct {
+	mu    sync.RWMutex
+	funcs map[string]ModifierFunc
+	types sync.Map // reflect.Type -> bool: does the type carry any mod tag?
+}
+
+// NewModifiers returns a registry preloaded with the built-in modifiers:
+//
+//	trim        strings.TrimSpace
+//	ltrim       trim leading whitespace
+//	rtrim       trim trailing whitespace
+//	lower       strings.ToLower
+//	upper       strings.ToUpper
+//	squash      collapse runs of whitespace into a single space
+//	strip_ctrl  replace control characters (including newlines and tabs) with a space
+func NewModifiers() *Modifiers {
+	return &Modifiers{funcs: map[string]ModifierFunc{
+		"trim":       strings.TrimSpace,
+		"ltrim":      func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+		"rtrim":      func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"squash":     func(s string) string { return strings.Join(strings.Fields(s), " ") },
+		"strip_ctrl": func(s string) string { return strings.Map(spaceControl, s) },
+	}}
+}
+
+// spaceControl is a strings.Map callback replacing control characters with a
+// space, so the words on either side stay apart.
+func spaceControl(r rune) rune {
+	if unicode.IsControl(r) {
+		return ' '
+	}
+	return r
+}
+
+// DefaultModifiers backs the default StructTransformer. Register custom
+// modifiers on it before building the Handlers that use them, or build a
+// separate registry with NewModifiers and inject it per-handler with
+// NewStructTransformer.
+var DefaultModifiers = NewModifiers()
+
+// Register adds or replaces the modifier called name. Handlers check their
+// `mod` tags when built, so register modifiers before building the Handlers
+// that use them.
+func (m *Modifiers) Register(name string, fn ModifierFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funcs[name] = fn
+}
+
+// lookup resolves a comma-separated `mod` tag into its ModifierFuncs.
+func (m *Modifiers) lookup(tag string) ([]ModifierFunc, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := strings.Split(tag, ",")
+	fns := make([]ModifierFunc, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		fn, ok := m.funcs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownModifier, name)
+		}
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
+
+// Apply runs the `mod` tags found on v, which must be a non-nil pointer to a
+// struct. Tagged strings are rewritten directly, or element-wise when held in
+// pointers, slices, arrays or map values. Nested structs (including those
+// inside slices, arrays, maps and pointers) are walked using their own tags.
+func (m *Modifiers) Apply(v any) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to a struct, got %T", v)
+	}
+	if !m.hasMods(val.Elem().Type(), nil) {
+		return nil // nothing to do; skip the walk entirely
+	}
+	return m.walk(val.Elem(), nil, val.Elem().Type().Name())
+}
+
+// Check reports the first `mod` tag on t, or on any struct reachable from it,
+// that names an unregistered modifier or is on a field holding no strings.
+func (m *Modifiers) Check(t reflect.Type) error {
+	return m.check(t, t.Name(), map[reflect.Type]bool{})
+}
+
+// check is Check for the type at path; seen guards against recursive types.
+func (m *Modifiers) check(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return m.check(t.Elem(), path, seen)
+	case reflect.Struct:
+		if seen[t] {
+			return nil
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if tag := field.Tag.Get(FieldMod); tag != "" {
+				if _, err := m.lookup(tag); err != nil {
+					return fmt.Errorf("field %s.%s: %w", path, field.Name, err)
+				}
+				if elemKind(field.Type) != reflect.String {
+					return fmt.Errorf("field %s.%s: %w", path, field.Name, ErrModifierField)
+				}
+			}
+			if err := m.check(field.Type, path+"."+field.Name, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elemKind returns the kind of t with pointers, slices, arrays and maps
+// unwrapped: the kind of the values a `mod` tag on t would modify.
+func elemKind(t reflect.Type) reflect.Kind {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t.Kind()
+		}
+	}
+}
+
+// walk applies fns to every string reachable from v and descends into nested
+// structs. path is the field namespace used in error messages.
+func (m *Modifiers) walk(v reflect.Value, fns []ModifierFunc, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		if len(fns) > 0 && v.CanSet() {
+			s := v.String()
+			for _, fn := range fns {
+				s = fn(s)
+			}
+			v.SetString(s)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return m.walk(v.Elem(), fns, path)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := m.walk(v.Index(i), fns, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map values aren't addressable: copy each out, modify, and store back
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := m.walk(elem, fns, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			var fieldFns []ModifierFunc
+			if tag := field.Tag.Get(FieldMod); tag != "" {
+				var err error
+				if fieldFns, err = m.lookup(tag); err != nil {
+					return fmt.Errorf("field %s.%s: %w", path, field.Name, err)
+				}
+			} else if !m.hasMods(field.Type, nil) {
+				continue
+			}
+
+			if err := m.walk(v.Field(i), fieldFns, path+"."+field.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasMods reports whether t, or any struct reachable from it, carries a `mod`
+// tag. Results are cached per type; seen guards against recursive types.
+func (m *Modifiers) hasMods(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if cached, ok := m.types.Load(t); ok {
+		return cached.(bool)
+	}
+	if seen[t] {
+		return false
+	}
+	root := seen == nil
+	if root {
+		seen = map[reflect.Type]bool{}
+	}
+	seen[t] = true
+
+	found := false
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		found = m.hasMods(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField() && !found; i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			found = field.Tag.Get(FieldMod) != "" || m.hasMods(field.Type, seen)
+		}
+	}
+
+	// A false found below the root may only mean a cycle was cut short, so
+	// only positive answers and the root's complete answer are cached.
+	if found || root {
+		m.types.Store(t, found)
+	}
+	return found
+}
+
+// NewStructTransformer returns a Transformer backed by m, for injecting a
+// specific modifier registry into a single Handler:
+//
+//	mid.Handler(h, mid.WithTransformer(mid.NewStructTransformer[Input](myMods)))
+//
+// It panics if T's `mod` tags fail Modifiers.Check, like the other checks
+// made when a Handler is built.
+func NewStructTransformer[T any](m *Modifiers) Transformer[T] {
+	if err := m.Check(reflect.TypeFor[T]()); err != nil {
+		panic(fmt.Errorf("mid: %w", err))
+	}
+	return func(input *T) error {
+		return m.Apply(input)
+	}
+}
+
+// StructTransformer is the zero-config default Transformer, backed by
+// DefaultModifiers.
+func StructTransformer[T any](input *T) error {
+	return DefaultModifiers.Apply(input)
+}
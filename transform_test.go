@@ -0,0 +1,141 @@
+package mid
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type Contact struct {
+	Email string   `json:"email" mod:"trim,lower" validate:"required,email"`
+	Tags  []string `json:"tags" mod:"trim,upper"`
+	Notes *string  `json:"notes" mod:"strip_ctrl,squash"`
+}
+
+type Signup struct {
+	Name     string             `json:"name" mod:"trim" validate:"required"`
+	Primary  Contact            `json:"primary"`
+	Others   []Contact          `json:"others"`
+	ByLabel  map[string]Contact `json:"by_label"`
+	Internal string             `json:"internal"` // untagged: left alone
+}
+
+// TestHandlerTransformsBeforeValidation verifies `mod` tags run between
+// decoding and validation, recursing into nested structs, slices and maps.
+func TestHandlerTransformsBeforeValidation(t *testing.T) {
+	var got Signup
+	handler := Handler(func(in Signup) (any, error) {
+		got = in
+		return nil, nil
+	})
+
+	body := `{
+		"name": "  Ada  ",
+		"primary": {"email": " ADA@Example.COM ", "tags": [" a ", "b "], "notes": "one\ttwo\n  three"},
+		"others": [{"email": " Bob@Example.com"}],
+		"by_label": {"work": {"email": "WORK@example.com "}},
+		"internal": "  raw  "
+	}`
+	recorder := serve(handler, body)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if got.Name != "Ada" {
+		t.Errorf("unexpected name %q", got.Name)
+	}
+	if got.Primary.Email != "ada@example.com" {
+		t.Errorf("unexpected primary email %q", got.Primary.Email)
+	}
+	if strings.Join(got.Primary.Tags, ",") != "A,B" {
+		t.Errorf("unexpected tags %q", got.Primary.Tags)
+	}
+	if got.Primary.Notes == nil || *got.Primary.Notes != "one two three" {
+		t.Errorf("unexpected notes %v", got.Primary.Notes)
+	}
+	if got.Others[0].Email != "bob@example.com" {
+		t.Errorf("unexpected slice email %q", got.Others[0].Email)
+	}
+	if got.ByLabel["work"].Email != "work@example.com" {
+		t.Errorf("unexpected map email %q", got.ByLabel["work"].Email)
+	}
+	if got.Internal != "  raw  " {
+		t.Errorf("expected untagged field to be untouched, got %q", got.Internal)
+	}
+}
+
+// TestHandlerTransformedValueFailsValidation verifies validation sees the
+// normalized value: a whitespace-only required field is rejected.
+func TestHandlerTransformedValueFailsValidation(t *testing.T) {
+	handler := Handler(func(in Signup) (any, error) { return nil, nil })
+	recorder := serve(handler, `{"name":"   ","primary":{"email":"a@b.co"}}`)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+type Slugged struct {
+	Slug string `mod:"trim,slug"`
+}
+
+// TestCustomModifiers covers registering a modifier on a private registry and
+// the error reported for an unregistered one.
+func TestCustomModifiers(t *testing.T) {
+	mods := NewModifiers()
+
+	in := Slugged{Slug: " Hello World "}
+	if err := mods.Apply(&in); !errors.Is(err, ErrUnknownModifier) {
+		t.Fatalf("expected ErrUnknownModifier, got %v", err)
+	}
+
+	mods.Register("slug", func(s string) string {
+		return strings.ReplaceAll(strings.ToLower(s), " ", "-")
+	})
+
+	var got Slugged
+	handler := Handler(func(in Slugged) (any, error) {
+		got = in
+		return nil, nil
+	}, WithTransformer(NewStructTransformer[Slugged](mods)))
+	serve(handler, `{"Slug":" Hello World "}`)
+
+	if got.Slug != "hello-world" {
+		t.Errorf("unexpected slug %q", got.Slug)
+	}
+}
+
+// TestModifierTagsCheckedAtBuild verifies bad `mod` tags panic when the
+// Handler is built rather than failing requests.
+func TestModifierTagsCheckedAtBuild(t *testing.T) {
+	type Unknown struct {
+		Name string `mod:"trim,shout"`
+	}
+	type NotString struct {
+		Age int `mod:"trim"`
+	}
+	type Nested struct {
+		Inner []struct {
+			Count *int `mod:"trim"`
+		}
+	}
+
+	expectPanic := func(name string, want error, build func()) {
+		t.Helper()
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, want) {
+				t.Errorf("%s: expected a panic with %v, got %v", name, want, err)
+			}
+		}()
+		build()
+	}
+	expectPanic("unknown", ErrUnknownModifier, func() { Handler(func(Unknown) (any, error) { return nil, nil }) })
+	expectPanic("not string", ErrModifierField, func() { Handler(func(NotString) (any, error) { return nil, nil }) })
+	expectPanic("nested", ErrModifierField, func() { Handler(func(Nested) (any, error) { return nil, nil }) })
+
+	// an overriding Transformer isn't held to the default registry
+	Handler(func(Unknown) (any, error) { return nil, nil },
+		WithTransformer(func(*Unknown) error { return nil }))
+}
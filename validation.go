@@ -15,9 +15,30 @@ type Validate interface {
 	Struct(s any) error
 }
 
-// DefaultValidator backs the default StructValidator. Replace it before first
-// use (e.g. to register custom rules) or inject a per-handler validator with
-// NewStructValidator instead.
+// ValidateFunc adapts an ordinary function to the Validate interface, in the
+// spirit of http.HandlerFunc, so a validation library without a Struct method
+// can be plugged in without declaring a type.
+type ValidateFunc func(s any) error
+
+// Struct calls f(s).
+func (f ValidateFunc) Struct(s any) error {
+	return f(s)
+}
+
+// FieldErrorer is implemented by errors that carry field-level failures. A
+// Validate implementation backed by another library (or a JSON Schema
+// validator) returns one so NewStructValidator can report a structured
+// ValidationErrors instead of falling through to the generic error path.
+type FieldErrorer interface {
+	error
+	FieldErrors() []FieldError
+}
+
+// DefaultValidator is the validator Handlers use when their Config sets none.
+// Each Handler reads it once, when built, so replace it (e.g. to register
+// custom rules) before building Handlers; replacing it later affects only
+// Handlers built afterwards and can't race requests. Config.Validator is the
+// more explicit alternative.
 var DefaultValidator Validate = validator.New()
 
 // FieldError is one failed validation constraint, projected from
@@ -34,7 +55,8 @@ type FieldError struct {
 // implements error so it can flow through the ErrorHandler like any other
 // failure; JSONErrorHandler renders it as a structured {errors: [...]} body.
 type ValidationErrors struct {
-	Errors []FieldError `json:"errors"`
+	Errors    []FieldError `json:"errors"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
 // Error implements the error interface.
@@ -42,13 +64,19 @@ func (v ValidationErrors) Error() string {
 	return fmt.Sprintf("%d validation errors", len(v.Errors))
 }
 
+// FieldErrors implements FieldErrorer.
+func (v ValidationErrors) FieldErrors() []FieldError {
+	return v.Errors
+}
+
 // NewStructValidator returns a Validator backed by v, for injecting a specific
 // validator into a single Handler:
 //
 //	mid.Handler(h, mid.WithValidator(mid.NewStructValidator[Input](myValidate)))
 //
-// Constraint failures are projected into a ValidationErrors; any other error
-// (e.g. *validator.InvalidValidationError) is returned as-is.
+// Constraint failures — go-playground's validator.ValidationErrors or any
+// error implementing FieldErrorer — are projected into a ValidationErrors; any
+// other error (e.g. *validator.InvalidValidationError) is returned as-is.
 func NewStructValidator[T any](v Validate) Validator[T] {
 	return func(input T) error {
 		err := v.Struct(input)
@@ -58,12 +86,16 @@ func NewStructValidator[T any](v Validate) Validator[T] {
 		if validateErrs, ok := errors.AsType[validator.ValidationErrors](err); ok {
 			return newValidationErrors(validateErrs)
 		}
+		if fieldErrs, ok := errors.AsType[FieldErrorer](err); ok {
+			return ValidationErrors{Errors: fieldErrs.FieldErrors()}
+		}
 		return err
 	}
 }
 
-// StructValidator is the zero-config default Validator, backed by
-// DefaultValidator.
+// StructValidator is the default Validator, backed by DefaultValidator. Used
+// directly, it reads DefaultValidator at each call; Handlers built without a
+// Config.Validator read it once instead, when built.
 func StructValidator[T any](input T) error {
 	return NewStructValidator[T](DefaultValidator)(input)
 }